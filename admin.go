@@ -2,19 +2,27 @@ package spool
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/spanner"
 	admin "cloud.google.com/go/spanner/admin/database/apiv1"
 	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/cloudspannerecosystem/memefish/ast"
 	"github.com/cloudspannerecosystem/spool/internal/db"
 	"github.com/cloudspannerecosystem/spool/model"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// Setup creates a new spool metadata database.
+// Setup creates a new spool metadata database, or upgrades the schema of an existing one.
 func Setup(ctx context.Context, conf *Config) error {
+	ddlStatements, err := ddlToStatements(db.SpoolSchema)
+	if err != nil {
+		return err
+	}
 	adminClient, err := admin.NewDatabaseAdminClient(ctx, conf.ClientOptions()...)
 	if err != nil {
 		return err
@@ -28,7 +36,7 @@ func Setup(ctx context.Context, conf *Config) error {
 		op, err := adminClient.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
 			Parent:          conf.Instance(),
 			CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", conf.DatabaseID()),
-			ExtraStatements: ddlToStatements(db.SpoolSchema),
+			ExtraStatements: ddlStatements,
 		})
 		if err != nil {
 			return err
@@ -39,11 +47,29 @@ func Setup(ctx context.Context, conf *Config) error {
 	} else if err != nil {
 		return err
 	} else {
-		// Database already exists. Try to update schema.
-		// Considerations when the database is created using terraform, etc.
+		// Database already exists. Add the tables, columns and indexes which are missing,
+		// such as those added by newer versions of spool or all of them if the database was created by terraform, etc.
+		resp, err := adminClient.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{
+			Database: conf.Database(),
+		})
+		if err != nil {
+			return err
+		}
+		current, err := ParseSchema([]byte(strings.Join(resp.GetStatements(), ";\n")))
+		if err != nil {
+			return err
+		}
+		target, err := ParseSchema(db.SpoolSchema)
+		if err != nil {
+			return err
+		}
+		stmts := upgradeStatements(current, target)
+		if len(stmts) == 0 {
+			return nil
+		}
 		op, err := adminClient.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
 			Database:   conf.Database(),
-			Statements: ddlToStatements(db.SpoolSchema),
+			Statements: stmts,
 		})
 		if err != nil {
 			return err
@@ -56,6 +82,30 @@ func Setup(ctx context.Context, conf *Config) error {
 	return nil
 }
 
+// upgradeStatements returns the DDL statements which add the tables, columns and indexes of target missing in current.
+// Unlike DiffSchema, nothing is dropped or changed, so objects added to the metadata database by others are kept.
+func upgradeStatements(current, target *Schema) []string {
+	stmts := []string{}
+	for _, nt := range target.Tables {
+		t := current.Table(nt.Name.SQL())
+		if t == nil {
+			stmts = append(stmts, nt.SQL())
+			continue
+		}
+		for _, nc := range nt.Columns {
+			if t.column(nc.Name.SQL()) < 0 {
+				stmts = append(stmts, (&ast.AlterTable{Name: nt.Name, TableAlteration: &ast.AddColumn{Column: nc}}).SQL())
+			}
+		}
+	}
+	for _, nidx := range target.Indexes {
+		if findIndex(current, nidx.Name.SQL()) == nil {
+			stmts = append(stmts, nidx.SQL())
+		}
+	}
+	return stmts
+}
+
 // ListAll gets all databases from the pool.
 func ListAll(ctx context.Context, conf *Config) ([]*model.SpoolDatabase, error) {
 	client, err := spanner.NewClient(ctx, conf.Database(), conf.ClientOptions()...)
@@ -65,65 +115,250 @@ func ListAll(ctx context.Context, conf *Config) ([]*model.SpoolDatabase, error)
 	return model.FindAllSpoolDatabases(ctx, client.ReadOnlyTransaction())
 }
 
-// CleanAll removes all idle databases.
+// CleanAll removes the databases of all schemas which pass filters, and resumes dropping
+// the databases left deleting by an interrupted clean regardless of filters.
 func CleanAll(ctx context.Context, conf *Config, filters ...func(sdb *model.SpoolDatabase) bool) error {
-	client, err := spanner.NewClient(ctx, conf.Database(), conf.ClientOptions()...)
+	plan, err := PlanCleanAll(ctx, conf, filters...)
 	if err != nil {
 		return err
 	}
-	return clean(ctx, client, conf, func(ctx context.Context, txn *spanner.ReadWriteTransaction) ([]*model.SpoolDatabase, error) {
-		sdbs, err := model.FindAllSpoolDatabases(ctx, txn)
-		if err != nil {
-			return nil, err
+	defer plan.Close()
+	return executeClean(ctx, plan)
+}
+
+// PlanCleanAll returns the plan of CleanAll without dropping any database.
+// The plan has its own clients, which must be released by Close.
+func PlanCleanAll(ctx context.Context, conf *Config, filters ...func(sdb *model.SpoolDatabase) bool) (*CleanPlan, error) {
+	client, err := spanner.NewClient(ctx, conf.Database(), conf.ClientOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	// The admin client is shared by all drops of the plan.
+	adminClient, err := admin.NewDatabaseAdminClient(ctx, conf.ClientOptions()...)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	closeClients := func() error {
+		client.Close()
+		return adminClient.Close()
+	}
+	sdbs, err := model.FindAllSpoolDatabases(ctx, client.Single())
+	if err != nil {
+		_ = closeClients()
+		return nil, err
+	}
+	plan := newCleanPlan(client, adminClient, conf, sdbs, filters...)
+	plan.close = closeClients
+	return plan, nil
+}
+
+// CleanPlan represents the databases to be dropped by Clean or CleanAll.
+// It can be shown to the user before calling Execute.
+type CleanPlan struct {
+	// Databases are the databases to be dropped.
+	Databases []*model.SpoolDatabase
+
+	client      *spanner.Client
+	adminClient *admin.DatabaseAdminClient
+	conf        *Config
+	// close releases the clients if they are owned by the plan, nil if they are owned by the Pool.
+	close func() error
+}
+
+// Close releases the clients of the plan made by PlanCleanAll.
+// It does nothing for the plan made by Pool.PlanClean, whose clients are owned by the Pool.
+func (plan *CleanPlan) Close() error {
+	if plan.close == nil {
+		return nil
+	}
+	return plan.close()
+}
+
+// defaultCleanParallelism is the number of databases dropped at a time unless WithCleanParallelism is set.
+const defaultCleanParallelism = 5
+
+// CleanOption represents an option for CleanPlan.Execute.
+type CleanOption func(*cleanOptions)
+
+type cleanOptions struct {
+	parallelism int
+	progress    func(r *CleanResult)
+}
+
+// WithCleanParallelism sets the number of databases dropped at a time.
+func WithCleanParallelism(n int) CleanOption {
+	return func(o *cleanOptions) {
+		o.parallelism = n
+	}
+}
+
+// WithCleanProgress sets the function called with the result of each database as soon as it is done.
+// Calls are never concurrent.
+func WithCleanProgress(f func(r *CleanResult)) CleanOption {
+	return func(o *cleanOptions) {
+		o.progress = f
+	}
+}
+
+func newCleanOptions(opts []CleanOption) *cleanOptions {
+	o := &cleanOptions{parallelism: defaultCleanParallelism, progress: func(*CleanResult) {}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// CleanResult represents the result of dropping a database.
+type CleanResult struct {
+	Database *model.SpoolDatabase
+	// Gone reports whether the database had already been dropped.
+	Gone bool
+	// Skipped reports whether the database was left because it had changed since the plan was made.
+	Skipped bool
+	Err     error
+}
+
+// newCleanPlan makes a plan of the databases passing filters.
+// Databases left deleting by an interrupted clean are always included so that the clean is resumed.
+func newCleanPlan(client *spanner.Client, adminClient *admin.DatabaseAdminClient, conf *Config, sdbs []*model.SpoolDatabase, filters ...func(sdb *model.SpoolDatabase) bool) *CleanPlan {
+	plan := &CleanPlan{Databases: []*model.SpoolDatabase{}, client: client, adminClient: adminClient, conf: conf}
+	for _, sdb := range sdbs {
+		if sdb.State == StateDeleting.Int64() || len(filter([]*model.SpoolDatabase{sdb}, filters...)) > 0 {
+			plan.Databases = append(plan.Databases, sdb)
 		}
-		return filter(sdbs, filters...), nil
-	})
+	}
+	return plan
 }
 
-func clean(ctx context.Context, client *spanner.Client, conf *Config, find func(ctx context.Context, txn *spanner.ReadWriteTransaction) ([]*model.SpoolDatabase, error)) error {
-	var dropErr error
-	if _, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
-		sdbs, err := find(ctx, txn)
-		if err != nil {
-			return err
+// Execute drops the databases in the plan and deletes their rows in three steps:
+// the rows are marked deleting, the databases are dropped concurrently outside of any transaction
+// and the row of each dropped database is deleted.
+// Databases which have changed since the plan was made, for example checked out, are skipped.
+// If a drop fails or Execute is interrupted, the row stays deleting and the next clean drops it again.
+// Databases whose drop has not started when ctx is done have the error of ctx in their results.
+// The returned error is only for marking the rows; failures of each database are in the results.
+func (plan *CleanPlan) Execute(ctx context.Context, opts ...CleanOption) ([]*CleanResult, error) {
+	o := newCleanOptions(opts)
+	results, err := plan.mark(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	sem := make(chan struct{}, max(o.parallelism, 1))
+	var wg sync.WaitGroup
+	for _, r := range results {
+		if r.Skipped {
+			mu.Lock()
+			o.progress(r)
+			mu.Unlock()
+			continue
 		}
-		ms := []*spanner.Mutation{}
-		for _, sdb := range sdbs {
-			dropErr = dropDatabase(ctx, conf.WithDatabaseID(sdb.DatabaseName))
-			if dropErr != nil {
-				st, ok := status.FromError(dropErr)
-				if ok && st.Code() == codes.NotFound {
-					// Database was not found, ignore this error and continue to the next database.
-					// Reset dropErr so it doesn't affect the final return value unless a subsequent, different error occurs.
-					dropErr = nil
-					fmt.Printf("%s was not deleted because it no longer exists.\n", sdb.DatabaseName)
-				} else {
-					// For any other error, break the loop.
-					break
-				}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+			// A database whose drop has not started when ctx is done stays deleting.
+			if err := ctx.Err(); err != nil {
+				r.Err = err
+			} else {
+				r.Gone, r.Err = plan.drop(ctx, r.Database)
 			}
-			ms = append(ms, sdb.Delete(ctx))
+			mu.Lock()
+			o.progress(r)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// drop drops the database and deletes its row. It reports whether the database had already been dropped.
+func (plan *CleanPlan) drop(ctx context.Context, sdb *model.SpoolDatabase) (bool, error) {
+	gone := false
+	if err := dropDatabase(ctx, plan.adminClient, plan.conf.WithDatabaseID(sdb.DatabaseName)); err != nil {
+		if status.Code(err) != codes.NotFound {
+			return false, err
 		}
-		if len(ms) > 0 {
-			if err := txn.BufferWrite(ms); err != nil {
+		gone = true
+	}
+	if _, err := plan.client.Apply(ctx, []*spanner.Mutation{sdb.Delete(ctx)}); err != nil {
+		return gone, err
+	}
+	return gone, nil
+}
+
+// mark changes the databases in the plan to deleting unless they have changed since the plan was made.
+func (plan *CleanPlan) mark(ctx context.Context) ([]*CleanResult, error) {
+	var results []*CleanResult
+	var marked []*model.SpoolDatabase
+	ts, err := plan.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		results = make([]*CleanResult, 0, len(plan.Databases))
+		marked = []*model.SpoolDatabase{}
+		ms := []*spanner.Mutation{}
+		for _, planned := range plan.Databases {
+			sdb, err := model.FindSpoolDatabase(ctx, txn, planned.DatabaseName)
+			if err != nil {
+				if isErrNotFound(err) {
+					results = append(results, &CleanResult{Database: planned, Skipped: true})
+					continue
+				}
 				return err
 			}
+			if !unchanged(sdb, planned) {
+				results = append(results, &CleanResult{Database: sdb, Skipped: true})
+				continue
+			}
+			if sdb.State != StateDeleting.Int64() {
+				// The row read is kept as it is in case the transaction is retried.
+				deleting := *sdb
+				if err := changeState(&deleting, StateDeleting); err != nil {
+					// Databases being created are left to Recover.
+					results = append(results, &CleanResult{Database: sdb, Skipped: true})
+					continue
+				}
+				deleting.UpdatedAt = spanner.CommitTimestamp
+				ms = append(ms, deleting.Update(ctx))
+				sdb = &deleting
+				marked = append(marked, sdb)
+			}
+			results = append(results, &CleanResult{Database: sdb})
 		}
-		return nil
-	}); err != nil {
-		return err
+		if len(ms) == 0 {
+			return nil
+		}
+		return txn.BufferWrite(ms)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if dropErr != nil {
-		return dropErr
+	for _, sdb := range marked {
+		sdb.UpdatedAt = ts
 	}
-	return nil
+	return results, nil
 }
 
-func dropDatabase(ctx context.Context, conf *Config) error {
-	adminClient, err := admin.NewDatabaseAdminClient(ctx, conf.ClientOptions()...)
+// executeClean executes plan and returns the errors of the databases which have not been dropped.
+func executeClean(ctx context.Context, plan *CleanPlan) error {
+	results, err := plan.Execute(ctx)
 	if err != nil {
 		return err
 	}
+	errs := []error{}
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Database.DatabaseName, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func dropDatabase(ctx context.Context, adminClient *admin.DatabaseAdminClient, conf *Config) error {
 	return adminClient.DropDatabase(ctx, &databasepb.DropDatabaseRequest{
 		Database: conf.Database(),
 	})
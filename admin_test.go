@@ -3,12 +3,16 @@ package spool
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"cloud.google.com/go/spanner"
 	admin "cloud.google.com/go/spanner/admin/database/apiv1"
 	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/cloudspannerecosystem/spool/internal/db"
 	"github.com/cloudspannerecosystem/spool/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func connect(ctx context.Context, t *testing.T, conf *Config) (*spanner.Client, func()) {
@@ -19,11 +23,24 @@ func connect(ctx context.Context, t *testing.T, conf *Config) (*spanner.Client,
 	}
 	t.Cleanup(client.Close)
 	return client, func() {
-		if err := clean(ctx, client, conf,
-			func(ctx context.Context, txn *spanner.ReadWriteTransaction) ([]*model.SpoolDatabase, error) {
-				return model.FindAllSpoolDatabases(ctx, txn)
-			},
-		); err != nil {
+		// Databases in any state including creating are dropped, unlike Clean.
+		sdbs, err := model.FindAllSpoolDatabases(ctx, client.Single())
+		if err != nil {
+			t.Fatal(err)
+		}
+		adminClient, err := admin.NewDatabaseAdminClient(ctx, conf.ClientOptions()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer adminClient.Close()
+		ms := []*spanner.Mutation{}
+		for _, sdb := range sdbs {
+			if err := dropDatabase(ctx, adminClient, conf.WithDatabaseID(sdb.DatabaseName)); err != nil && status.Code(err) != codes.NotFound {
+				t.Fatal(err)
+			}
+			ms = append(ms, sdb.Delete(ctx))
+		}
+		if _, err := client.Apply(ctx, ms); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -129,3 +146,72 @@ func TestCleanAll(t *testing.T) {
 		t.Error("failed to clean all")
 	}
 }
+
+func TestModelColumns(t *testing.T) {
+	t.Parallel()
+
+	// The models are generated from the metadata schema by make gen, so they must have the same columns.
+	schema, err := ParseSchema(db.SpoolSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]string{
+		"SpoolDatabases": model.SpoolDatabaseColumns(),
+		"SpoolWaiters":   model.SpoolWaiterColumns(),
+	}
+	for name, columns := range tests {
+		table := schema.Table(name)
+		if table == nil {
+			t.Fatalf("%s is not in the schema", name)
+		}
+		expected := make([]string, 0, len(table.Columns))
+		for _, c := range table.Columns {
+			expected = append(expected, c.Name.SQL())
+		}
+		if !reflect.DeepEqual(expected, columns) {
+			t.Errorf("%s: expected columns %v but got %v; run make gen", name, expected, columns)
+		}
+	}
+}
+
+func TestUpgradeStatements(t *testing.T) {
+	t.Parallel()
+
+	// The schema of the metadata database created by the first release.
+	current, err := ParseSchema([]byte(`CREATE TABLE SpoolDatabases (
+  DatabaseName STRING(MAX) NOT NULL,
+  Checksum STRING(MAX) NOT NULL,
+  State INT64 NOT NULL,
+  CreatedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  UpdatedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),
+  Extra STRING(MAX),
+) PRIMARY KEY(DatabaseName);
+CREATE INDEX SpoolDatabasesByChecksumAndState ON SpoolDatabases(Checksum, State);
+CREATE INDEX SpoolDatabasesByUpdatedAt ON SpoolDatabases(UpdatedAt)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := ParseSchema(db.SpoolSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is dropped, and only the missing columns and tables are added.
+	expected := []string{
+		"ALTER TABLE SpoolDatabases ADD COLUMN LeaseExpiresAt TIMESTAMP",
+		"ALTER TABLE SpoolDatabases ADD COLUMN CheckoutToken STRING(MAX)",
+		"ALTER TABLE SpoolDatabases ADD COLUMN HolderHostname STRING(MAX)",
+		"ALTER TABLE SpoolDatabases ADD COLUMN HolderPID INT64",
+		"ALTER TABLE SpoolDatabases ADD COLUMN HolderUser STRING(MAX)",
+		"ALTER TABLE SpoolDatabases ADD COLUMN HolderJobID STRING(MAX)",
+		"ALTER TABLE SpoolDatabases ADD COLUMN MigrationVersion INT64",
+		"ALTER TABLE SpoolDatabases ADD COLUMN OperationName STRING(MAX)",
+		target.Table("SpoolWaiters").SQL(),
+	}
+	if got := upgradeStatements(current, target); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %q but got %q", expected, got)
+	}
+	if got := upgradeStatements(target, target); len(got) != 0 {
+		t.Errorf("expected no statements for the latest schema but got %q", got)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -20,6 +24,7 @@ const (
 	envGoogleCloudProjectID = "GOOGLE_CLOUD_PROJECT"
 	envInstanceID           = "SPANNER_INSTANCE_ID"
 	envDatabaseID           = "SPOOL_SPANNER_DATABASE_ID"
+	envToken                = "SPOOL_TOKEN"
 )
 
 var (
@@ -27,38 +32,108 @@ var (
 )
 
 var (
-	app        = kingpin.New("spool", "A CLI tool to manage Cloud Spanner databases for testing.").Version(versionInfo())
-	projectID  = app.Flag("project", "Set GCP project ID. (use $SPANNER_PROJECT_ID or $GOOGLE_CLOUD_PROJECT as default value)").Short('p').String()
-	instanceID = app.Flag("instance", "Set Cloud Spanner instance name. (use $SPANNER_INSTANCE_ID as default value)").Short('i').String()
-	databaseID = app.Flag("database", "Set Cloud Spanner database name. (use $SPOOL_SPANNER_DATABASE_ID as default value)").Short('d').String()
-	schemaFile = app.Flag("schema", "Set schema file path.").Short('s').File()
+	app             = kingpin.New("spool", "A CLI tool to manage Cloud Spanner databases for testing.").Version(versionInfo())
+	projectID       = app.Flag("project", "Set GCP project ID. (use $SPANNER_PROJECT_ID or $GOOGLE_CLOUD_PROJECT as default value)").Short('p').String()
+	instanceID      = app.Flag("instance", "Set Cloud Spanner instance name. (use $SPANNER_INSTANCE_ID as default value)").Short('i').String()
+	databaseID      = app.Flag("database", "Set Cloud Spanner database name. (use $SPOOL_SPANNER_DATABASE_ID as default value)").Short('d').String()
+	schemaPath      = app.Flag("schema", "Set schema file path. (or a directory of numbered migration files)").Short('s').ExistingFileOrDir()
+	seedPaths       = app.Flag("seed", "Set seed data path. (a DML SQL file or a directory of SQL and per-table CSV/JSON fixtures, repeatable)").ExistingFilesOrDirs()
+	maxSize         = app.Flag("max-size", "Set the maximum number of databases with the schema. (unlimited by default)").Int()
+	maxInstanceSize = app.Flag("max-instance-size", "Set the maximum number of databases of all schemas. (unlimited by default)").Int()
 
 	setup = app.Command("setup", "Setup the database for spool metadata.")
 
+	checksum = app.Command("checksum", "Print the checksum of the schema and the normalized statements it is computed from.")
+
+	schema        = app.Command("schema", "Inspect schemas.")
+	schemaDiff    = schema.Command("diff", "Print DDL statements which turn the old schema into the new schema.")
+	schemaDiffOld = schemaDiff.Arg("old", "old schema file path (or a directory of numbered migration files)").Required().ExistingFileOrDir()
+	schemaDiffNew = schemaDiff.Arg("new", "new schema file path (or a directory of numbered migration files)").Required().ExistingFileOrDir()
+
 	create                   = app.Command("create", "Add new databases to the pool.")
 	createDatabaseNamePrefix = create.Flag("db-name-prefix", "Set new database name prefix.").Required().String()
 	createDatabaseNum        = create.Flag("num", "Set the number of new databases.").Default("1").Int()
+	createParallelism        = create.Flag("parallelism", "Set the number of databases created at a time.").Default("5").Int()
+	createNameTemplate       = create.Flag("name-template", "Set the template of new database names. ({prefix}, {checksum8}, {timestamp}, {rand} and {env:NAME} are replaced)").Default(spool.DefaultNameTemplate).String()
 
-	get = app.Command("get", "Get a idle database from the pool.")
+	get           = app.Command("get", "Get a idle database from the pool.")
+	getLease      = get.Flag("lease", "Release the database automatically if it is not returned within the duration. (e.g. 30m)").Duration()
+	getPrintToken = get.Flag("print-token", "Print the checkout token after the database name.").Default("false").Bool()
+	getJobID      = get.Flag("job-id", "Set the job ID recorded as the holder. (detected from CI environment variables by default)").String()
+	getWait       = get.Flag("wait", "Wait for a database to become idle up to the duration. (e.g. 10m)").Duration()
 
 	getOrCreate                   = app.Command("get-or-create", "Get or create a idle database from the pool.")
 	getOrCreateDatabaseNamePrefix = getOrCreate.Flag("db-name-prefix", "Set new database name prefix.").Required().String()
+	getOrCreateLease              = getOrCreate.Flag("lease", "Release the database automatically if it is not returned within the duration. (e.g. 30m)").Duration()
+	getOrCreatePrintToken         = getOrCreate.Flag("print-token", "Print the checkout token after the database name.").Default("false").Bool()
+	getOrCreateJobID              = getOrCreate.Flag("job-id", "Set the job ID recorded as the holder. (detected from CI environment variables by default)").String()
+	getOrCreateWaitTimeout        = getOrCreate.Flag("wait-timeout", "Wait for a database to be returned up to the duration when the pool is full. (e.g. 10m)").Duration()
+	getOrCreateNameTemplate       = getOrCreate.Flag("name-template", "Set the template of new database names. ({prefix}, {checksum8}, {timestamp}, {rand} and {env:NAME} are replaced)").Default(spool.DefaultNameTemplate).String()
+
+	renew             = app.Command("renew", "Extend the lease of the database.")
+	renewDatabaseName = renew.Arg("database", "database name").Required().String()
+	renewToken        = renew.Flag("token", "Set the checkout token. (use $SPOOL_TOKEN as default value)").Envar(envToken).Required().String()
+	renewLease        = renew.Flag("lease", "Set the new lease duration from now. (e.g. 30m)").Required().Duration()
+
+	run                   = app.Command("run", "Run the command with a database from the pool and return the database after the command exits.")
+	runDatabaseNamePrefix = run.Flag("db-name-prefix", "Set new database name prefix.").Required().String()
+	runLease              = run.Flag("lease", "Release the database automatically if it is not returned within the duration. (e.g. 30m)").Duration()
+	runJobID              = run.Flag("job-id", "Set the job ID recorded as the holder. (detected from CI environment variables by default)").String()
+	runWaitTimeout        = run.Flag("wait-timeout", "Wait for a database to be returned up to the duration when the pool is full. (e.g. 10m)").Duration()
+	runReset              = run.Flag("reset", "Delete all rows in the database before returning it.").Default("false").Bool()
+	runArgs               = run.Arg("command", "command and arguments to run (use -- before the command)").Required().Strings()
+
+	maintain                   = app.Command("maintain", "Create databases until the pool has the minimum number of idle databases.")
+	maintainDatabaseNamePrefix = maintain.Flag("db-name-prefix", "Set new database name prefix.").Required().String()
+	maintainMinIdle            = maintain.Flag("min-idle", "Set the number of idle databases to keep.").Required().Int()
+	maintainInterval           = maintain.Flag("interval", "Keep maintaining at the interval instead of exiting after once. (e.g. 5m)").Duration()
+
+	recoverCmd    = app.Command("recover", "Resume or drop databases stuck in creating after the creating process died.")
+	recoverDryRun = recoverCmd.Flag("dry-run", "Print the stuck databases without resolving them.").Default("false").Bool()
+
+	reconcile               = app.Command("reconcile", "Compare the metadata with the databases on the instance and report or fix the differences.")
+	reconcileDatabasePrefix = reconcile.Flag("db-name-prefix", "Report databases with the prefix and without metadata as orphans. (repeatable)").Strings()
+	reconcileFix            = reconcile.Flag("fix", "Fix the differences: purge rows of missing databases and resolve orphans by --orphans.").Default("false").Bool()
+	reconcileOrphans        = reconcile.Flag("orphans", "Set how --fix resolves orphan databases. (keep, adopt or drop)").Default(string(spool.OrphanKeep)).Enum(string(spool.OrphanKeep), string(spool.OrphanAdopt), string(spool.OrphanDrop))
 
 	list    = app.Command("list", "Print databases.")
 	listAll = list.Flag("all", "Print databases. (without checksum filtering)").Default("false").Bool()
 
 	put             = app.Command("put", "Return the database to the pool.")
 	putDatabaseName = put.Arg("database", "database name").Required().String()
+	putToken        = put.Flag("token", "Set the checkout token. (use $SPOOL_TOKEN as default value)").Envar(envToken).String()
+	putForce        = put.Flag("force", "Return the database without checking the checkout token.").Default("false").Bool()
+	putReset        = put.Flag("reset", "Delete all rows in the database before returning it.").Default("false").Bool()
+
+	quarantine             = app.Command("quarantine", "Mark the database as quarantined so that it is never reused.")
+	quarantineDatabaseName = quarantine.Arg("database", "database name").Required().String()
+	quarantineToken        = quarantine.Flag("token", "Set the checkout token. (use $SPOOL_TOKEN as default value)").Envar(envToken).String()
 
 	clean                     = app.Command("clean", "Drop all idle databases.")
 	cleanAll                  = clean.Flag("all", "Drop all idle databases. (without checksum filtering)").Default("false").Bool()
 	cleanIgnoreUsedWithinDays = clean.Flag("ignore-used-within-days", "Ignore databases which used within n days.").Int64()
 	cleanForce                = clean.Flag("force", "Drop all databases. (include busy databases)").Default("false").Bool()
+	cleanDryRun               = clean.Flag("dry-run", "Print the databases to be dropped without dropping them.").Default("false").Bool()
+	cleanYes                  = clean.Flag("yes", "Drop the databases without confirmation.").Short('y').Default("false").Bool()
+	cleanParallelism          = clean.Flag("parallelism", "Set the number of databases dropped at a time.").Default("5").Int()
 )
 
 func main() {
-	ctx := context.Background()
+	// Interrupted commands clean up what they were creating. A second signal terminates spool immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	switch cmd {
+	case checksum.FullCommand():
+		printChecksum()
+		return
+	case schemaDiff.FullCommand():
+		os.Exit(printSchemaDiff())
+	}
 	if err := loadEnvVarsIfNeeded(); err != nil {
 		kingpin.Fatalf("%s, try --help", err)
 	}
@@ -69,21 +144,123 @@ func main() {
 	case setup.FullCommand():
 		kingpin.FatalIfError(spool.Setup(ctx, config), "failed to setup")
 	case create.FullCommand():
-		pool := newPool(ctx, config)
-		for range *createDatabaseNum {
-			_, err := pool.Create(ctx, *createDatabaseNamePrefix)
-			kingpin.FatalIfError(err, "failed to create database")
+		pool := newPool(ctx, config, spool.WithNameTemplate(*createNameTemplate))
+		failed := 0
+		for i, result := range pool.CreateN(ctx, *createDatabaseNamePrefix, *createDatabaseNum, *createParallelism) {
+			if result.Err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create database %d/%d: %s\n", i+1, *createDatabaseNum, result.Err)
+				failed++
+				continue
+			}
+			fmt.Println(result.Database.DatabaseName)
+		}
+		if failed > 0 {
+			kingpin.Fatalf("failed to create %d of %d databases", failed, *createDatabaseNum)
 		}
 	case get.FullCommand():
 		pool := newPool(ctx, config)
-		sdb, err := pool.Get(ctx)
+		start := time.Now()
+		sdb, err := pool.Get(ctx, spool.WithLease(*getLease), spool.WithJobID(*getJobID), spool.WithWaitTimeout(*getWait))
+		if *getWait > 0 {
+			fmt.Fprintf(os.Stderr, "waited %s\n", time.Since(start).Round(time.Millisecond))
+		}
 		kingpin.FatalIfError(err, "failed to get database")
-		fmt.Print(sdb.DatabaseName)
+		printDatabase(sdb, *getPrintToken)
 	case getOrCreate.FullCommand():
+		pool := newPool(ctx, config, spool.WithNameTemplate(*getOrCreateNameTemplate))
+		sdb, err := pool.GetOrCreate(ctx, *getOrCreateDatabaseNamePrefix, spool.WithLease(*getOrCreateLease), spool.WithJobID(*getOrCreateJobID), spool.WithWaitTimeout(*getOrCreateWaitTimeout))
+		kingpin.FatalIfError(err, "failed to get or create database")
+		printDatabase(sdb, *getOrCreatePrintToken)
+	case renew.FullCommand():
 		pool := newPool(ctx, config)
-		sdb, err := pool.GetOrCreate(ctx, *getOrCreateDatabaseNamePrefix)
+		_, err := pool.Renew(ctx, *renewDatabaseName, *renewToken, *renewLease)
+		kingpin.FatalIfError(err, "failed to renew database")
+	case run.FullCommand():
+		pool := newPool(ctx, config)
+		sdb, err := pool.GetOrCreate(ctx, *runDatabaseNamePrefix, spool.WithLease(*runLease), spool.WithJobID(*runJobID), spool.WithWaitTimeout(*runWaitTimeout))
 		kingpin.FatalIfError(err, "failed to get or create database")
-		fmt.Print(sdb.DatabaseName)
+		env := append(os.Environ(),
+			fmt.Sprintf("%s=%s", envRunDatabaseID, sdb.DatabaseName),
+			fmt.Sprintf("%s=%s", envRunDatabaseName, config.WithDatabaseID(sdb.DatabaseName).Database()),
+			fmt.Sprintf("%s=%s", envToken, sdb.CheckoutToken.StringVal),
+		)
+		code, runErr := runCommand(*runArgs, env)
+		// Return the database even if ctx has been canceled.
+		putCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		putOpts := []spool.PutOption{}
+		if *runReset {
+			putOpts = append(putOpts, spool.WithReset())
+		}
+		putErr := pool.Put(putCtx, sdb.DatabaseName, sdb.CheckoutToken.StringVal, putOpts...)
+		cancel()
+		kingpin.FatalIfError(runErr, "failed to run command")
+		kingpin.FatalIfError(putErr, "failed to put database")
+		os.Exit(code)
+	case maintain.FullCommand():
+		pool := newPool(ctx, config, spool.WithMinIdle(*maintainMinIdle, *maintainDatabaseNamePrefix))
+		for {
+			sdbs, err := pool.Maintain(ctx)
+			for _, sdb := range sdbs {
+				fmt.Println(sdb.DatabaseName)
+			}
+			kingpin.FatalIfError(err, "failed to maintain databases")
+			if *maintainInterval <= 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(*maintainInterval):
+			}
+		}
+	case recoverCmd.FullCommand():
+		pool := newPool(ctx, config)
+		sdbs, err := pool.ListStuck(ctx)
+		kingpin.FatalIfError(err, "failed to list stuck databases")
+		failed := 0
+		for _, sdb := range sdbs {
+			if *recoverDryRun {
+				operation := sdb.OperationName.StringVal
+				if operation == "" {
+					operation = "-"
+				}
+				fmt.Printf("%s\t%s\n", sdb.DatabaseName, operation)
+				continue
+			}
+			result, err := pool.Recover(ctx, sdb.DatabaseName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to recover %s: %s\n", sdb.DatabaseName, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s\t%s\n", sdb.DatabaseName, result)
+		}
+		if failed > 0 {
+			kingpin.Fatalf("failed to recover %d of %d databases", failed, len(sdbs))
+		}
+	case reconcile.FullCommand():
+		pool := newPool(ctx, config)
+		drifts, err := pool.Reconcile(ctx, *reconcileDatabasePrefix)
+		kingpin.FatalIfError(err, "failed to reconcile databases")
+		failed := 0
+		for _, d := range drifts {
+			result := "-"
+			if *reconcileFix {
+				fixed, err := pool.FixDrift(ctx, d, spool.OrphanAction(*reconcileOrphans))
+				switch {
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "failed to fix %s %s: %s\n", d.Kind, d.DatabaseName, err)
+					result = "failed"
+					failed++
+				case fixed:
+					result = "fixed"
+				}
+			}
+			fmt.Printf("%s\t%s\t%s\n", d.Kind, d.DatabaseName, result)
+		}
+		if failed > 0 {
+			kingpin.Fatalf("failed to fix %d of %d differences", failed, len(drifts))
+		}
 	case list.FullCommand():
 		var sdbs []*model.SpoolDatabase
 		var err error
@@ -96,16 +273,33 @@ func main() {
 		kingpin.FatalIfError(err, "failed to get databases")
 		w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 		for _, sdb := range sdbs {
-			_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", sdb.DatabaseName, sdb.Checksum, spool.State(sdb.State), sdb.CreatedAt.In(time.Local), sdb.UpdatedAt.In(time.Local))
+			_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sdb.DatabaseName, sdb.Checksum, spool.State(sdb.State), sdb.CreatedAt.In(time.Local), sdb.UpdatedAt.In(time.Local), formatLease(sdb), formatHolder(sdb))
 			kingpin.FatalIfError(err, "failed to print databases")
 		}
 		if err := w.Flush(); err != nil {
 			kingpin.FatalIfError(err, "failed to print databases")
 		}
 	case put.FullCommand():
+		if *putToken == "" && !*putForce {
+			kingpin.Fatalf("put requires --token or $%s printed by get --print-token, or --force to skip the check", envToken)
+		}
 		pool := newPool(ctx, config)
-		err := pool.Put(ctx, *putDatabaseName)
+		opts := []spool.PutOption{}
+		if *putForce {
+			opts = append(opts, spool.WithForce())
+		}
+		if *putReset {
+			opts = append(opts, spool.WithReset())
+		}
+		err := pool.Put(ctx, *putDatabaseName, *putToken, opts...)
 		kingpin.FatalIfError(err, "failed to put database")
+	case quarantine.FullCommand():
+		if *quarantineToken == "" {
+			kingpin.Fatalf("quarantine requires --token or $%s printed by get --print-token", envToken)
+		}
+		pool := newPool(ctx, config)
+		err := pool.Quarantine(ctx, *quarantineDatabaseName, *quarantineToken)
+		kingpin.FatalIfError(err, "failed to quarantine database")
 	case clean.FullCommand():
 		filters := []func(*model.SpoolDatabase) bool{}
 		if cleanIgnoreUsedWithinDays != nil {
@@ -114,14 +308,54 @@ func main() {
 		if !*cleanForce {
 			filters = append(filters, spool.FilterState(spool.StateIdle))
 		}
+		var plan *spool.CleanPlan
 		var err error
 		if *cleanAll {
-			err = spool.CleanAll(ctx, config, filters...)
+			plan, err = spool.PlanCleanAll(ctx, config, filters...)
 		} else {
 			pool := newPool(ctx, config)
-			err = pool.Clean(ctx, filters...)
+			plan, err = pool.PlanClean(ctx, filters...)
+		}
+		kingpin.FatalIfError(err, "failed to clean database")
+		defer plan.Close()
+		if *cleanDryRun {
+			kingpin.FatalIfError(printCleanPlan(os.Stdout, plan), "failed to print databases")
+			return
 		}
+		if len(plan.Databases) == 0 {
+			return
+		}
+		if !*cleanYes && isTerminal(os.Stdin) {
+			kingpin.FatalIfError(printCleanPlan(os.Stderr, plan), "failed to print databases")
+			ok, err := confirm(os.Stdin, os.Stderr, fmt.Sprintf("Drop %d databases on %s?", len(plan.Databases), config.Instance()))
+			kingpin.FatalIfError(err, "failed to read confirmation")
+			if !ok {
+				fmt.Fprintln(os.Stderr, "canceled")
+				return
+			}
+		}
+		var dropped, gone, skipped, failed int
+		_, err = plan.Execute(ctx, spool.WithCleanParallelism(*cleanParallelism), spool.WithCleanProgress(func(r *spool.CleanResult) {
+			switch {
+			case r.Err != nil:
+				fmt.Fprintf(os.Stderr, "failed to drop %s: %s\n", r.Database.DatabaseName, r.Err)
+				failed++
+			case r.Skipped:
+				fmt.Printf("%s\tskipped\n", r.Database.DatabaseName)
+				skipped++
+			case r.Gone:
+				fmt.Printf("%s\talready gone\n", r.Database.DatabaseName)
+				gone++
+			default:
+				fmt.Printf("%s\tdropped\n", r.Database.DatabaseName)
+				dropped++
+			}
+		}))
 		kingpin.FatalIfError(err, "failed to clean database")
+		fmt.Fprintf(os.Stderr, "dropped %d, already gone %d, skipped %d, failed %d\n", dropped, gone, skipped, failed)
+		if failed > 0 {
+			kingpin.Fatalf("failed to drop %d of %d databases; run clean again to retry", failed, len(plan.Databases))
+		}
 	}
 }
 
@@ -152,17 +386,152 @@ func loadEnvVarsIfNeeded() error {
 	return nil
 }
 
-func newPool(ctx context.Context, config *spool.Config) *spool.Pool {
-	if *schemaFile == nil {
-		kingpin.Fatalf("required flag --schema not provided, try --help")
+func newPool(ctx context.Context, config *spool.Config, opts ...spool.Option) *spool.Pool {
+	ddl, migrations := loadSchema()
+	if *maxSize > 0 {
+		opts = append(opts, spool.WithMaxSize(*maxSize))
+	}
+	if *maxInstanceSize > 0 {
+		opts = append(opts, spool.WithMaxInstanceSize(*maxInstanceSize))
+	}
+	if seed := loadSeed(); seed != nil {
+		opts = append(opts, spool.WithSeed(seed))
+	}
+	var pool *spool.Pool
+	var err error
+	if migrations != nil {
+		pool, err = spool.NewPoolFromMigrations(ctx, config, migrations, opts...)
+	} else {
+		pool, err = spool.NewPool(ctx, config, ddl, opts...)
 	}
-	ddl, err := io.ReadAll(*schemaFile)
-	kingpin.FatalIfError(err, "failed to read schema file")
-	pool, err := spool.NewPool(ctx, config, ddl)
 	kingpin.FatalIfError(err, "")
 	return pool
 }
 
+// loadSchema reads the schema file, or the migration files if the schema path is a directory.
+func loadSchema() ([]byte, []*spool.Migration) {
+	if *schemaPath == "" {
+		kingpin.Fatalf("required flag --schema not provided, try --help")
+	}
+	return readSchema(*schemaPath)
+}
+
+func readSchema(path string) ([]byte, []*spool.Migration) {
+	info, err := os.Stat(path)
+	kingpin.FatalIfError(err, "failed to read schema file")
+	if info.IsDir() {
+		migrations, err := spool.LoadMigrations(path)
+		kingpin.FatalIfError(err, "failed to read migration files")
+		return spool.MigrationsDDL(migrations), migrations
+	}
+	ddl, err := os.ReadFile(path) // #nosec G304 -- reading the given schema file is intended
+	kingpin.FatalIfError(err, "failed to read schema file")
+	return ddl, nil
+}
+
+func loadSeed() *spool.Seed {
+	if len(*seedPaths) == 0 {
+		return nil
+	}
+	seed, err := spool.LoadSeed(*seedPaths...)
+	kingpin.FatalIfError(err, "failed to read seed")
+	return seed
+}
+
+func printChecksum() {
+	ddl, _ := loadSchema()
+	normalized, err := spool.NormalizeDDL(ddl)
+	kingpin.FatalIfError(err, "failed to parse schema file")
+	fmt.Println(spool.Checksum(normalized, loadSeed()))
+	for _, stmt := range normalized {
+		fmt.Printf("%s;\n", stmt)
+	}
+}
+
+// printSchemaDiff prints the statements and reports the changes which cannot be applied in place.
+// It returns the exit status, which is 1 if there are such changes.
+func printSchemaDiff() int {
+	parse := func(path string) *spool.Schema {
+		ddl, _ := readSchema(path)
+		s, err := spool.ParseSchema(ddl)
+		kingpin.FatalIfError(err, "failed to parse %s", path)
+		return s
+	}
+	diff := spool.DiffSchema(parse(*schemaDiffOld), parse(*schemaDiffNew))
+	for _, stmt := range diff.Statements {
+		fmt.Printf("%s;\n", stmt)
+	}
+	for _, msg := range diff.Incompatible {
+		fmt.Fprintf(os.Stderr, "cannot be applied in place: %s\n", msg)
+	}
+	if len(diff.Incompatible) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printDatabase(sdb *model.SpoolDatabase, withToken bool) {
+	if withToken {
+		fmt.Printf("%s %s\n", sdb.DatabaseName, sdb.CheckoutToken.StringVal)
+		return
+	}
+	fmt.Print(sdb.DatabaseName)
+}
+
+// printCleanPlan prints the databases to be dropped with their state, checksum and last use.
+func printCleanPlan(out io.Writer, plan *spool.CleanPlan) error {
+	w := tabwriter.NewWriter(out, 0, 8, 1, '\t', 0)
+	for _, sdb := range plan.Databases {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", sdb.DatabaseName, spool.State(sdb.State), sdb.Checksum, sdb.UpdatedAt.In(time.Local)); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks the question and reports whether the answer is yes. Anything other than y or yes is no.
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	if _, err := fmt.Fprintf(out, "%s [y/N] ", question); err != nil {
+		return false, err
+	}
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+func formatLease(sdb *model.SpoolDatabase) string {
+	if !sdb.LeaseExpiresAt.Valid {
+		return "-"
+	}
+	if sdb.LeaseExpired(time.Now()) {
+		return fmt.Sprintf("expired(%s)", sdb.LeaseExpiresAt.Time.In(time.Local))
+	}
+	return sdb.LeaseExpiresAt.Time.In(time.Local).String()
+}
+
+func formatHolder(sdb *model.SpoolDatabase) string {
+	h := spool.HolderOf(sdb)
+	if h == nil {
+		return "-"
+	}
+	return h.String()
+}
+
 func versionInfo() string {
 	if versionStr != "" {
 		return versionStr
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -133,6 +135,33 @@ func TestLoadEnvVarsIfNeeded(t *testing.T) {
 	}
 }
 
+func TestConfirm(t *testing.T) {
+	tests := map[string]bool{
+		"y\n":   true,
+		"YES\n": true,
+		" yes ": true,
+		"n\n":   false,
+		"\n":    false,
+		"":      false,
+		"yep\n": false,
+	}
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := confirm(strings.NewReader(input), &out, "Drop?")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != expected {
+				t.Errorf("expected %t but got %t", expected, got)
+			}
+			if expected, got := "Drop? [y/N] ", out.String(); expected != got {
+				t.Errorf("expected prompt %q but got %q", expected, got)
+			}
+		})
+	}
+}
+
 func ptr(s string) *string {
 	return &s
 }
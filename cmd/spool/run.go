@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+const (
+	envRunDatabaseID   = "SPANNER_DATABASE_ID"
+	envRunDatabaseName = "SPANNER_DATABASE_NAME"
+)
+
+// runCommand runs args as a child process with env and returns its exit code.
+// SIGINT and SIGTERM are forwarded to the child process while it is running,
+// except SIGINT sent by the terminal, which already delivers it to the child.
+func runCommand(args []string, env []string) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...) // #nosec G204 -- running the given command is the purpose of `spool run`
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	interactive := isTerminal(os.Stdin)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if shouldForward(sig, interactive) {
+					_ = cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			// Follow the shell convention for processes killed by a signal.
+			return 128 + int(ws.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// shouldForward reports whether sig received by spool should be sent to the child process.
+// The child shares the process group of spool, so Ctrl-C in the terminal sends SIGINT to both of them.
+// Forwarding it again would make children which treat a second SIGINT as a force quit exit immediately.
+// SIGINT from other processes cannot be told apart from it, so it is only forwarded when stdin is not a terminal, as in CI.
+func shouldForward(sig os.Signal, interactive bool) bool {
+	return sig != syscall.SIGINT || !interactive
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	tests := map[string]struct {
+		args   []string
+		env    []string
+		expect int
+		fail   bool
+	}{
+		"success": {
+			args:   []string{"/bin/sh", "-c", "exit 0"},
+			expect: 0,
+		},
+		"pass through exit code": {
+			args:   []string{"/bin/sh", "-c", "exit 3"},
+			expect: 3,
+		},
+		"killed by signal": {
+			args:   []string{"/bin/sh", "-c", "kill -TERM $$"},
+			expect: 128 + 15,
+		},
+		"environment variables": {
+			args:   []string{"/bin/sh", "-c", `test "${SPANNER_DATABASE_ID}" = "db"`},
+			env:    []string{"SPANNER_DATABASE_ID=db"},
+			expect: 0,
+		},
+		"command not found": {
+			args: []string{filepath.Join(t.TempDir(), "not-found")},
+			fail: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			code, err := runCommand(test.args, append(os.Environ(), test.env...))
+			if test.fail {
+				if err == nil {
+					t.Fatal("expected error but no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if code != test.expect {
+				t.Errorf("expected exit code %d but got %d", test.expect, code)
+			}
+		})
+	}
+}
+
+func TestShouldForward(t *testing.T) {
+	tests := map[string]struct {
+		sig         os.Signal
+		interactive bool
+		expect      bool
+	}{
+		"SIGINT in a terminal":     {sig: syscall.SIGINT, interactive: true, expect: false},
+		"SIGINT without terminal":  {sig: syscall.SIGINT, interactive: false, expect: true},
+		"SIGTERM in a terminal":    {sig: syscall.SIGTERM, interactive: true, expect: true},
+		"SIGTERM without terminal": {sig: syscall.SIGTERM, interactive: false, expect: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := shouldForward(test.sig, test.interactive); got != test.expect {
+				t.Errorf("expected %t but got %t", test.expect, got)
+			}
+		})
+	}
+}
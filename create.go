@@ -0,0 +1,63 @@
+package spool
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cloudspannerecosystem/spool/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// quotaRetries is the number of attempts of an admin request which fails with ResourceExhausted.
+	quotaRetries = 6
+	// minQuotaRetryInterval and maxQuotaRetryInterval bound the backoff between the attempts.
+	minQuotaRetryInterval = time.Second
+	maxQuotaRetryInterval = 30 * time.Second
+)
+
+// CreateResult is the result of one of the databases created by CreateN.
+type CreateResult struct {
+	// Database is the created database, nil if Err is set.
+	Database *model.SpoolDatabase
+	Err      error
+}
+
+// CreateN creates n databases concurrently, running at most parallelism creations at a time.
+// It returns the result of each database. A database which fails to be created leaves no row in the pool,
+// and the failure does not stop the others.
+func (p *Pool) CreateN(ctx context.Context, dbNamePrefix string, n, parallelism int) []*CreateResult {
+	results := make([]*CreateResult, n)
+	sem := make(chan struct{}, max(parallelism, 1))
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			sdb, err := p.Create(ctx, dbNamePrefix)
+			results[i] = &CreateResult{Database: sdb, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// retryResourceExhausted calls f until it succeeds or fails with other errors than ResourceExhausted,
+// up to quotaRetries times with an exponential backoff.
+func retryResourceExhausted(ctx context.Context, f func() error) error {
+	interval := minQuotaRetryInterval
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if status.Code(err) != codes.ResourceExhausted || attempt >= quotaRetries {
+			return err
+		}
+		if err := sleep(ctx, jitter(interval)); err != nil {
+			return err
+		}
+		interval = min(interval*2, maxQuotaRetryInterval)
+	}
+}
@@ -0,0 +1,154 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudspannerecosystem/spool/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPool_CreateN(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	results := pool.CreateN(ctx, spoolSpannerDatabaseNamePrefix(), 3, 2)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results but got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if _, err := model.FindSpoolDatabase(ctx, client.Single(), result.Database.DatabaseName); err != nil {
+			t.Error(err)
+		}
+	}
+
+	results = pool.CreateN(ctx, "Invalid", 2, 2)
+	for _, result := range results {
+		if !errors.Is(result.Err, ErrInvalidDatabaseName) {
+			t.Errorf("expected ErrInvalidDatabaseName but got %v", result.Err)
+		}
+	}
+	sdbs, err := pool.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sdbs) != 3 {
+		t.Errorf("expected 3 databases but got %d", len(sdbs))
+	}
+}
+
+func TestRetryResourceExhausted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	calls := 0
+	err := retryResourceExhausted(ctx, func() error {
+		calls++
+		if calls == 1 {
+			return status.Error(codes.ResourceExhausted, "quota exceeded")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls but got %d", calls)
+	}
+
+	calls = 0
+	err = retryResourceExhausted(ctx, func() error {
+		calls++
+		return status.Error(codes.InvalidArgument, "invalid")
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument but got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call but got %d", calls)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = retryResourceExhausted(canceled, func() error {
+		return status.Error(codes.ResourceExhausted, "quota exceeded")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
+
+func TestPool_CreateCanceled(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+
+	t.Run("canceled before creating", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := pool.Create(canceled, spoolSpannerDatabaseNamePrefix()); err == nil {
+			t.Fatal("expected an error")
+		}
+		sdbs, err := pool.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sdbs) != 0 {
+			t.Errorf("expected no databases but got %d", len(sdbs))
+		}
+	})
+	t.Run("interrupted while creating", func(t *testing.T) {
+		createCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Cancel the creation as soon as its row appears, as Ctrl-C does.
+		seen := make(chan string, 1)
+		go func() {
+			defer cancel()
+			for createCtx.Err() == nil {
+				sdbs, err := model.FindSpoolDatabasesByChecksumState(ctx, client.Single(), pool.checksum, StateCreating.Int64())
+				if err == nil && len(sdbs) > 0 {
+					seen <- sdbs[0].DatabaseName
+					return
+				}
+			}
+		}()
+		sdb, err := pool.Create(createCtx, spoolSpannerDatabaseNamePrefix())
+		if err == nil {
+			t.Skipf("%s was created before the cancellation", sdb.DatabaseName)
+		}
+		if !errors.Is(err, context.Canceled) && status.Code(err) != codes.Canceled {
+			t.Fatalf("expected cancellation but got %v", err)
+		}
+
+		dbName := <-seen
+		if _, err := model.FindSpoolDatabase(ctx, client.Single(), dbName); !isErrNotFound(err) {
+			t.Errorf("expected the row of %s to be deleted but got %v", dbName, err)
+		}
+		exist, err := pool.existDatabase(ctx, dbName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exist {
+			t.Errorf("expected %s to be dropped", dbName)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package spool
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cloudspannerecosystem/memefish"
+	"github.com/cloudspannerecosystem/memefish/token"
+)
+
+// ddlKeywords is a list of non-reserved keywords and type names used in DDL.
+// They are lexed as identifiers, but their case is normalized like reserved keywords.
+var ddlKeywords = map[string]struct{}{}
+
+func init() {
+	for _, k := range strings.Fields(`
+		ACTION ADD ALTER ARRAY BIT_REVERSED_POSITIVE BOOL BYTES CASCADE CHANGE CHECK COLUMN CONSTRAINT
+		COUNTER DATABASE DATE DEFINER DELETE DELETION DROP FLOAT32 FLOAT64 FOREIGN GENERATED GRANT HIDDEN
+		INDEX INT64 INTERLEAVE INVOKER JSON KEY MAX MODEL NULL_FILTERED NUMERIC OLDER_THAN OPTIONS PARENT
+		PLACEMENT POLICY PRIMARY REFERENCES RENAME REPLACE REVOKE ROLE ROW SCHEMA SEARCH SECURITY SEQUENCE
+		SQL STORED STORING STREAM STRING SYNONYM TABLE TIMESTAMP TOKENLIST UNIQUE UPDATE VECTOR VIEW`) {
+		ddlKeywords[k] = struct{}{}
+	}
+}
+
+// SyntaxError represents malformed input found while tokenizing SQL.
+type SyntaxError struct {
+	// Line and Column are 1-origin.
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error returns an error message with the position.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// ddlToStatements splits ddl into statements at terminating semicolons.
+// Semicolons in string and bytes literals, quoted identifiers and comments don't terminate a statement.
+// Comments are removed from the statements and statements without tokens are omitted.
+func ddlToStatements(ddl []byte) ([]string, error) {
+	stmts, err := tokenize(ddl)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(stmts))
+	for _, tokens := range stmts {
+		res = append(res, render(tokens))
+	}
+	return res, nil
+}
+
+// NormalizeDDL splits ddl into statements in a normalized form.
+// Comments are removed, tokens are separated by a single space, keywords are upper-cased
+// and trailing commas before closing parentheses are removed.
+func NormalizeDDL(ddl []byte) ([]string, error) {
+	stmts, err := tokenize(ddl)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(stmts))
+	for _, tokens := range stmts {
+		res = append(res, normalize(tokens))
+	}
+	return res, nil
+}
+
+// Checksum returns the checksum which identifies databases in the pool from the normalized statements and the seed.
+// Without the seed, it is the SHA-256 of the statements each followed by ";\n".
+// seed can be nil.
+func Checksum(normalized []string, seed *Seed) string {
+	h := sha256.New()
+	for _, stmt := range normalized {
+		_, _ = io.WriteString(h, stmt+";\n")
+	}
+	sum := fmt.Sprintf("%x", h.Sum(nil))
+	if seed == nil {
+		return sum
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(sum+seed.Checksum())))
+}
+
+// legacyChecksum returns the checksum which spool computed from the raw DDL before the statements were normalized.
+func legacyChecksum(ddl []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(ddl))
+}
+
+// tokenize splits src into statements of tokens.
+func tokenize(src []byte) ([][]token.Token, error) {
+	lex := &memefish.Lexer{
+		File: &token.File{
+			Buffer: string(src),
+		},
+	}
+	var stmts [][]token.Token
+	var tokens []token.Token
+	for {
+		if err := lex.NextToken(); err != nil {
+			var e *memefish.Error
+			if errors.As(err, &e) {
+				return nil, &SyntaxError{
+					Line:    e.Position.Line + 1,
+					Column:  e.Position.Column + 1,
+					Message: e.Message,
+				}
+			}
+			return nil, err
+		}
+		switch lex.Token.Kind {
+		case token.TokenEOF, ";":
+			if len(tokens) > 0 {
+				stmts = append(stmts, tokens)
+				tokens = nil
+			}
+			if lex.Token.Kind == token.TokenEOF {
+				return stmts, nil
+			}
+		default:
+			tokens = append(tokens, lex.Token)
+		}
+	}
+}
+
+func normalize(tokens []token.Token) string {
+	parts := make([]string, 0, len(tokens))
+	for i, tok := range tokens {
+		if tok.Kind == "," && i+1 < len(tokens) && tokens[i+1].Kind == ")" {
+			continue
+		}
+		parts = append(parts, normalizeToken(tok))
+	}
+	return strings.Join(parts, " ")
+}
+
+func normalizeToken(tok token.Token) string {
+	if _, ok := token.KeywordsMap[tok.Kind]; ok {
+		return string(tok.Kind)
+	}
+	if tok.Kind == token.TokenIdent && !strings.HasPrefix(tok.Raw, "`") {
+		if upper := strings.ToUpper(tok.Raw); isDDLKeyword(upper) {
+			return upper
+		}
+	}
+	return tok.Raw
+}
+
+func isDDLKeyword(s string) bool {
+	_, ok := ddlKeywords[s]
+	return ok
+}
+
+// render joins tokens with their original spacing, replacing comments with spaces.
+func render(tokens []token.Token) string {
+	var b strings.Builder
+	for i, tok := range tokens {
+		if i > 0 {
+			space := tok.Space
+			if n := len(tok.Comments); n > 0 {
+				// Line comments consume their newline.
+				if strings.HasSuffix(tok.Comments[n-1].Raw, "\n") {
+					space = "\n" + space
+				}
+				if space == "" {
+					space = tok.Comments[0].Space
+				}
+				if space == "" {
+					space = " "
+				}
+			}
+			b.WriteString(space)
+		}
+		b.WriteString(tok.Raw)
+	}
+	return b.String()
+}
@@ -0,0 +1,174 @@
+package spool
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDDLToStatements(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ddl    string
+		expect []string
+	}{
+		"simple": {
+			ddl:    "CREATE TABLE A (ID INT64) PRIMARY KEY(ID);\nCREATE INDEX AByID ON A(ID);\n",
+			expect: []string{"CREATE TABLE A (ID INT64) PRIMARY KEY(ID)", "CREATE INDEX AByID ON A(ID)"},
+		},
+		"without terminating semicolon": {
+			ddl:    "CREATE TABLE A (ID INT64) PRIMARY KEY(ID)",
+			expect: []string{"CREATE TABLE A (ID INT64) PRIMARY KEY(ID)"},
+		},
+		"semicolon in string literal": {
+			ddl:    "ALTER DATABASE db SET OPTIONS (default_leader = 'a;b');",
+			expect: []string{"ALTER DATABASE db SET OPTIONS (default_leader = 'a;b')"},
+		},
+		"semicolon in triple-quoted string": {
+			ddl:    "CREATE VIEW V SQL SECURITY INVOKER AS SELECT \"\"\"a;\n'b'\"\"\" AS S;",
+			expect: []string{"CREATE VIEW V SQL SECURITY INVOKER AS SELECT \"\"\"a;\n'b'\"\"\" AS S"},
+		},
+		"semicolon in bytes literal": {
+			ddl:    "CREATE TABLE A (B BYTES(MAX) DEFAULT (b';')) PRIMARY KEY(B);",
+			expect: []string{"CREATE TABLE A (B BYTES(MAX) DEFAULT (b';')) PRIMARY KEY(B)"},
+		},
+		"semicolon in check constraint": {
+			ddl:    "CREATE TABLE A (S STRING(MAX), CHECK (S != ';')) PRIMARY KEY(S);",
+			expect: []string{"CREATE TABLE A (S STRING(MAX), CHECK (S != ';')) PRIMARY KEY(S)"},
+		},
+		"semicolon in backquoted identifier": {
+			ddl:    "CREATE TABLE `A;B` (ID INT64) PRIMARY KEY(ID);",
+			expect: []string{"CREATE TABLE `A;B` (ID INT64) PRIMARY KEY(ID)"},
+		},
+		"comments": {
+			ddl:    "-- comment;\nCREATE TABLE A ( # comment;\n  ID INT64 /* comment; */\n) PRIMARY KEY(ID);\n-- trailing comment;\n",
+			expect: []string{"CREATE TABLE A (\n  ID INT64\n) PRIMARY KEY(ID)"},
+		},
+		"empty statements": {
+			ddl:    ";;\n;",
+			expect: []string{},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ddlToStatements([]byte(test.ddl))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("expected %q but got %q", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestDDLToStatements_SyntaxError(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ddl    string
+		line   int
+		column int
+	}{
+		"unclosed string literal": {
+			ddl:    "CREATE TABLE A (\n  S STRING(MAX) DEFAULT ('a),\n) PRIMARY KEY(S);",
+			line:   2,
+			column: 26,
+		},
+		"unclosed comment": {
+			ddl:    "CREATE TABLE A (ID INT64) PRIMARY KEY(ID);\n/* comment",
+			line:   2,
+			column: 1,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ddlToStatements([]byte(test.ddl))
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected SyntaxError but got %v", err)
+			}
+			if syntaxErr.Line != test.line || syntaxErr.Column != test.column {
+				t.Errorf("expected %d:%d but got %d:%d", test.line, test.column, syntaxErr.Line, syntaxErr.Column)
+			}
+		})
+	}
+}
+
+func TestNormalizeDDL(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		ddl    string
+		expect []string
+	}{
+		"whitespace and comments": {
+			ddl: "-- users\nCREATE TABLE Users (\n\tID   INT64 NOT NULL, /* id */\n  Name STRING(MAX),\n) PRIMARY KEY (ID);\n\n",
+			expect: []string{
+				"CREATE TABLE Users ( ID INT64 NOT NULL , Name STRING ( MAX ) ) PRIMARY KEY ( ID )",
+			},
+		},
+		"keyword case": {
+			ddl: "create table Users (id int64 not null, name string(max)) primary key (id);\ncreate index UsersByName on Users(name)",
+			expect: []string{
+				"CREATE TABLE Users ( id INT64 NOT NULL , name STRING ( MAX ) ) PRIMARY KEY ( id )",
+				"CREATE INDEX UsersByName ON Users ( name )",
+			},
+		},
+		"quoted identifiers and literals": {
+			ddl: "CREATE TABLE `table` (`Key` STRING(10) DEFAULT ('a  b')) PRIMARY KEY (`Key`)",
+			expect: []string{
+				"CREATE TABLE `table` ( `Key` STRING ( 10 ) DEFAULT ( 'a  b' ) ) PRIMARY KEY ( `Key` )",
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NormalizeDDL([]byte(test.ddl))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("expected %q but got %q", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	ddl1 := []byte("CREATE TABLE Users (ID INT64 NOT NULL) PRIMARY KEY (ID);")
+	ddl2 := []byte("-- users\ncreate table Users (\n  ID int64 not null,\n)\nprimary key(ID)\n")
+	ddl3 := []byte("CREATE TABLE Users (ID INT64) PRIMARY KEY (ID);")
+
+	n1, err := NormalizeDDL(ddl1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := NormalizeDDL(ddl2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n3, err := NormalizeDDL(ddl3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Checksum(n1, nil) != Checksum(n2, nil) {
+		t.Errorf("expected the same checksum but got %q and %q", Checksum(n1, nil), Checksum(n2, nil))
+	}
+	if Checksum(n1, nil) == Checksum(n3, nil) {
+		t.Errorf("expected different checksums but got %q", Checksum(n1, nil))
+	}
+	// Older versions of spool used the SHA-256 of the raw DDL.
+	if expected, got := "88e8bc5ee45ece84d275da6d957332db446e31add9e7da5034d38ecf1e8f4d86", legacyChecksum(ddl1); expected != got {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+}
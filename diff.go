@@ -0,0 +1,289 @@
+package spool
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudspannerecosystem/memefish/ast"
+)
+
+// SchemaDiff represents the changes which turn a schema into another.
+type SchemaDiff struct {
+	// Statements are DDL statements in the order to be applied.
+	Statements []string
+	// Incompatible describes changes which cannot be applied in place, such as primary key changes,
+	// type changes other than between STRING and BYTES, and NOT NULL columns added without a default value.
+	// They are not included in Statements and need a manual migration, such as recreating the table.
+	Incompatible []string
+}
+
+// DiffSchema returns the changes which turn from into to.
+//
+// Objects which depend on others are dropped first and created last:
+// views, change streams, indexes and constraints which are removed or changed are dropped,
+// then tables are dropped, altered and created, and finally the new definitions are created.
+// Changed views and change streams are recreated rather than altered,
+// because they may refer to columns which are dropped or added in between.
+func DiffSchema(from, to *Schema) *SchemaDiff {
+	d := &SchemaDiff{}
+
+	for _, v := range slices.Backward(from.Views) {
+		if nv := findView(to, v.Name.SQL()); nv == nil || nv.SQL() != v.SQL() {
+			d.add(&ast.DropView{Name: v.Name})
+		}
+	}
+	for _, cs := range slices.Backward(from.ChangeStreams) {
+		if ncs := findChangeStream(to, cs.Name.SQL()); ncs == nil || ncs.SQL() != cs.SQL() {
+			d.add(&ast.DropChangeStream{Name: cs.Name})
+		}
+	}
+	for _, idx := range slices.Backward(from.Indexes) {
+		if nidx := findIndex(to, idx.Name.SQL()); nidx == nil || nidx.SQL() != idx.SQL() {
+			d.add(&ast.DropIndex{Name: idx.Name})
+		}
+	}
+
+	// Constraints are dropped before tables because foreign keys may refer to dropped tables.
+	for _, t := range from.Tables {
+		nt := to.Table(t.Name.SQL())
+		if nt == nil {
+			continue
+		}
+		for _, c := range t.Constraints {
+			if nc := findConstraint(nt, c); nc != nil && nc.SQL() == c.SQL() {
+				continue
+			}
+			if c.Name == nil {
+				d.incompatible("unnamed constraint %s of %s cannot be dropped", c.SQL(), t.Name.SQL())
+				continue
+			}
+			d.add(&ast.AlterTable{Name: t.Name, TableAlteration: &ast.DropConstraint{Name: c.Name}})
+		}
+	}
+
+	// Interleaved tables are defined after their parents, so they are dropped in reverse order.
+	for _, t := range slices.Backward(from.Tables) {
+		if to.Table(t.Name.SQL()) == nil {
+			d.add(&ast.DropTable{Name: t.Name})
+		}
+	}
+	for _, nt := range to.Tables {
+		if t := from.Table(nt.Name.SQL()); t != nil {
+			d.alterTable(t, nt)
+		}
+	}
+	for _, nt := range to.Tables {
+		if from.Table(nt.Name.SQL()) == nil {
+			d.Statements = append(d.Statements, nt.SQL())
+		}
+	}
+
+	for _, nt := range to.Tables {
+		t := from.Table(nt.Name.SQL())
+		if t == nil {
+			continue
+		}
+		for _, nc := range nt.Constraints {
+			if c := findConstraint(t, nc); c != nil && c.SQL() == nc.SQL() {
+				continue
+			}
+			d.add(&ast.AlterTable{Name: nt.Name, TableAlteration: &ast.AddTableConstraint{TableConstraint: nc}})
+		}
+	}
+	for _, nidx := range to.Indexes {
+		if idx := findIndex(from, nidx.Name.SQL()); idx == nil || idx.SQL() != nidx.SQL() {
+			d.add(nidx)
+		}
+	}
+	for _, ncs := range to.ChangeStreams {
+		if cs := findChangeStream(from, ncs.Name.SQL()); cs == nil || cs.SQL() != ncs.SQL() {
+			d.add(ncs)
+		}
+	}
+	for _, nv := range to.Views {
+		if v := findView(from, nv.Name.SQL()); v == nil || v.SQL() != nv.SQL() {
+			d.add(nv)
+		}
+	}
+	return d
+}
+
+// alterTable adds the statements which turn the columns, interleaving and row deletion policy of t into nt.
+func (d *SchemaDiff) alterTable(t, nt *Table) {
+	if sqlList(t.PrimaryKey) != sqlList(nt.PrimaryKey) {
+		d.incompatible("primary key of %s cannot be changed from (%s) to (%s)", nt.Name.SQL(), sqlList(t.PrimaryKey), sqlList(nt.PrimaryKey))
+	}
+	switch {
+	case parentName(t) != parentName(nt):
+		d.incompatible("parent of %s cannot be changed from %q to %q", nt.Name.SQL(), parentName(t), parentName(nt))
+	case nt.Interleave != nil && onDelete(t.Interleave) != onDelete(nt.Interleave):
+		d.alter(nt, &ast.SetOnDelete{OnDelete: onDelete(nt.Interleave)})
+	}
+
+	for _, c := range t.Columns {
+		if nt.column(c.Name.SQL()) < 0 {
+			d.alter(nt, &ast.DropColumn{Name: c.Name})
+		}
+	}
+	for _, nc := range nt.Columns {
+		i := t.column(nc.Name.SQL())
+		if i < 0 {
+			if nc.NotNull && nc.DefaultSemantics == nil {
+				// Rows which already exist would have no value for the column.
+				d.incompatible("column %s.%s cannot be added as NOT NULL without a default value", nt.Name.SQL(), nc.Name.SQL())
+				continue
+			}
+			d.alter(nt, &ast.AddColumn{Column: nc})
+			continue
+		}
+		d.alterColumn(nt, t.Columns[i], nc)
+	}
+
+	switch {
+	case t.RowDeletionPolicy == nil && nt.RowDeletionPolicy != nil:
+		d.alter(nt, &ast.AddRowDeletionPolicy{RowDeletionPolicy: nt.RowDeletionPolicy})
+	case t.RowDeletionPolicy != nil && nt.RowDeletionPolicy == nil:
+		d.alter(nt, &ast.DropRowDeletionPolicy{})
+	case t.RowDeletionPolicy != nil && t.RowDeletionPolicy.SQL() != nt.RowDeletionPolicy.SQL():
+		d.alter(nt, &ast.ReplaceRowDeletionPolicy{RowDeletionPolicy: nt.RowDeletionPolicy})
+	}
+}
+
+func (d *SchemaDiff) alterColumn(nt *Table, c, nc *ast.ColumnDef) {
+	if c.SQL() == nc.SQL() {
+		return
+	}
+	_, generated := c.DefaultSemantics.(*ast.GeneratedColumnExpr)
+	_, nowGenerated := nc.DefaultSemantics.(*ast.GeneratedColumnExpr)
+	if generated || nowGenerated || c.Hidden.Invalid() != nc.Hidden.Invalid() {
+		d.incompatible("column %s.%s cannot be changed from %q to %q", nt.Name.SQL(), nc.Name.SQL(), c.SQL(), nc.SQL())
+		return
+	}
+	if typeFamily(c.Type) != typeFamily(nc.Type) {
+		d.incompatible("type of column %s.%s cannot be changed from %s to %s", nt.Name.SQL(), nc.Name.SQL(), c.Type.SQL(), nc.Type.SQL())
+		return
+	}
+
+	typ := &ast.AlterColumnType{Type: nc.Type, NotNull: nc.NotNull}
+	if def, ok := nc.DefaultSemantics.(*ast.ColumnDefaultExpr); ok {
+		typ.DefaultExpr = def
+	}
+	if c.Type.SQL() != nc.Type.SQL() || c.NotNull != nc.NotNull || defaultSQL(c.DefaultSemantics) != defaultSQL(nc.DefaultSemantics) {
+		d.alter(nt, &ast.AlterColumn{Name: nc.Name, Alteration: typ})
+	}
+
+	if optionsSQL(c.Options) != optionsSQL(nc.Options) {
+		options := &ast.Options{}
+		if nc.Options != nil {
+			options.Records = append(options.Records, nc.Options.Records...)
+		}
+		// Options which are no longer set are reset to null.
+		if c.Options != nil {
+			for _, r := range c.Options.Records {
+				if !slices.ContainsFunc(options.Records, func(nr *ast.OptionsDef) bool { return sameName(nr.Name.SQL(), r.Name.SQL()) }) {
+					options.Records = append(options.Records, &ast.OptionsDef{Name: r.Name, Value: &ast.NullLiteral{}})
+				}
+			}
+		}
+		d.alter(nt, &ast.AlterColumn{Name: nc.Name, Alteration: &ast.AlterColumnSetOptions{Options: options}})
+	}
+}
+
+func (d *SchemaDiff) add(stmt ast.DDL) {
+	d.Statements = append(d.Statements, stmt.SQL())
+}
+
+func (d *SchemaDiff) alter(t *Table, alteration ast.TableAlteration) {
+	d.add(&ast.AlterTable{Name: t.Name, TableAlteration: alteration})
+}
+
+func (d *SchemaDiff) incompatible(format string, args ...interface{}) {
+	d.Incompatible = append(d.Incompatible, fmt.Sprintf(format, args...))
+}
+
+func findIndex(s *Schema, name string) *ast.CreateIndex {
+	if i := indexOf(s.Indexes, indexName, name); i >= 0 {
+		return s.Indexes[i]
+	}
+	return nil
+}
+
+func findChangeStream(s *Schema, name string) *ast.CreateChangeStream {
+	if i := indexOf(s.ChangeStreams, changeStreamName, name); i >= 0 {
+		return s.ChangeStreams[i]
+	}
+	return nil
+}
+
+func findView(s *Schema, name string) *ast.CreateView {
+	if i := indexOf(s.Views, viewName, name); i >= 0 {
+		return s.Views[i]
+	}
+	return nil
+}
+
+// findConstraint finds the constraint in t which has the same name as c.
+// Unnamed constraints are identified by their definitions.
+func findConstraint(t *Table, c *ast.TableConstraint) *ast.TableConstraint {
+	for _, tc := range t.Constraints {
+		if c.Name == nil && tc.Name == nil && tc.SQL() == c.SQL() {
+			return tc
+		}
+		if c.Name != nil && tc.Name != nil && sameName(c.Name.SQL(), tc.Name.SQL()) {
+			return tc
+		}
+	}
+	return nil
+}
+
+func parentName(t *Table) string {
+	if t.Interleave == nil {
+		return ""
+	}
+	return t.Interleave.TableName.SQL()
+}
+
+// onDelete returns the ON DELETE action of the interleaving. NO ACTION is the default.
+func onDelete(c *ast.Cluster) ast.OnDeleteAction {
+	if c == nil || c.OnDelete == "" {
+		return ast.OnDeleteNoAction
+	}
+	return c.OnDelete
+}
+
+func sqlList[T ast.Node](nodes []T) string {
+	s := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		s = append(s, n.SQL())
+	}
+	return strings.Join(s, ", ")
+}
+
+// typeFamily returns the name shared by the types which a column can be changed between in place.
+// Only the length of STRING and BYTES, and the change between them, can be altered, also as array elements.
+func typeFamily(t ast.SchemaType) string {
+	switch t := t.(type) {
+	case *ast.SizedSchemaType:
+		return "STRING or BYTES"
+	case *ast.ArraySchemaType:
+		return "ARRAY<" + typeFamily(t.Item) + ">"
+	default:
+		return t.SQL()
+	}
+}
+
+// defaultSQL returns the SQL of the default value or the generated column expression, or an empty string.
+func defaultSQL(s ast.ColumnDefaultSemantics) string {
+	if s == nil {
+		return ""
+	}
+	return s.SQL()
+}
+
+func optionsSQL(o *ast.Options) string {
+	if o == nil {
+		return ""
+	}
+	return o.SQL()
+}
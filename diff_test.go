@@ -0,0 +1,149 @@
+package spool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		from         string
+		to           string
+		statements   []string
+		incompatible int
+	}{
+		"no changes in formatting": {
+			from: "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL) PRIMARY KEY(ISBN);",
+			to:   "create table Books (\n  ISBN string(max) not null, -- key\n) primary key (ISBN)",
+		},
+		"add and drop columns": {
+			from: "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Old INT64) PRIMARY KEY(ISBN);",
+			to:   "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Title STRING(MAX)) PRIMARY KEY(ISBN);",
+			statements: []string{
+				"ALTER TABLE Books DROP COLUMN Old",
+				"ALTER TABLE Books ADD COLUMN Title STRING(MAX)",
+			},
+		},
+		"alter column": {
+			from: "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Title STRING(10), UpdatedAt TIMESTAMP) PRIMARY KEY(ISBN);",
+			to:   "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Title STRING(MAX) NOT NULL DEFAULT (''), UpdatedAt TIMESTAMP OPTIONS (allow_commit_timestamp = true)) PRIMARY KEY(ISBN);",
+			statements: []string{
+				`ALTER TABLE Books ALTER COLUMN Title STRING(MAX) NOT NULL DEFAULT ("")`,
+				"ALTER TABLE Books ALTER COLUMN UpdatedAt SET OPTIONS (allow_commit_timestamp = true)",
+			},
+		},
+		"alter column between string and bytes": {
+			from: "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Cover STRING(MAX), Tags ARRAY<STRING(10)>) PRIMARY KEY(ISBN);",
+			to:   "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Cover BYTES(MAX), Tags ARRAY<BYTES(MAX)>) PRIMARY KEY(ISBN);",
+			statements: []string{
+				"ALTER TABLE Books ALTER COLUMN Cover BYTES(MAX)",
+				"ALTER TABLE Books ALTER COLUMN Tags ARRAY<BYTES(MAX)>",
+			},
+		},
+		"incompatible type changes": {
+			from:         "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Pages INT64, Price STRING(MAX), Tags ARRAY<INT64>) PRIMARY KEY(ISBN);",
+			to:           "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Pages STRING(MAX), Price INT64, Tags ARRAY<STRING(MAX)>) PRIMARY KEY(ISBN);",
+			incompatible: 3,
+		},
+		"add not null column": {
+			from: "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL) PRIMARY KEY(ISBN);",
+			to:   "CREATE TABLE Books (ISBN STRING(MAX) NOT NULL, Title STRING(MAX) NOT NULL, Pages INT64 NOT NULL DEFAULT (0)) PRIMARY KEY(ISBN);",
+			statements: []string{
+				"ALTER TABLE Books ADD COLUMN Pages INT64 NOT NULL DEFAULT (0)",
+			},
+			incompatible: 1,
+		},
+		"create and drop tables in dependency order": {
+			from: "CREATE TABLE A (ID INT64) PRIMARY KEY(ID);\nCREATE TABLE B (ID INT64, BID INT64) PRIMARY KEY(ID, BID), INTERLEAVE IN PARENT A;",
+			to:   "CREATE TABLE C (ID INT64) PRIMARY KEY(ID);\nCREATE TABLE D (ID INT64, DID INT64) PRIMARY KEY(ID, DID), INTERLEAVE IN PARENT C ON DELETE CASCADE;",
+			statements: []string{
+				"DROP TABLE B",
+				"DROP TABLE A",
+				"CREATE TABLE C (\n  ID INT64\n) PRIMARY KEY (ID)",
+				"CREATE TABLE D (\n  ID INT64,\n  DID INT64\n) PRIMARY KEY (ID, DID),\n  INTERLEAVE IN PARENT C ON DELETE CASCADE",
+			},
+		},
+		"indexes and foreign keys": {
+			from: "CREATE TABLE A (ID INT64, Name STRING(MAX)) PRIMARY KEY(ID);\n" +
+				"CREATE TABLE B (ID INT64, AID INT64, CONSTRAINT FK_A FOREIGN KEY (AID) REFERENCES A (ID)) PRIMARY KEY(ID);\n" +
+				"CREATE INDEX AByName ON A(Name);",
+			to: "CREATE TABLE A (ID INT64, Name STRING(MAX)) PRIMARY KEY(ID);\n" +
+				"CREATE TABLE B (ID INT64, AID INT64, CONSTRAINT FK_A FOREIGN KEY (AID) REFERENCES A (ID) ON DELETE CASCADE) PRIMARY KEY(ID);\n" +
+				"CREATE INDEX AByName ON A(Name DESC);",
+			statements: []string{
+				"DROP INDEX AByName",
+				"ALTER TABLE B DROP CONSTRAINT FK_A",
+				"ALTER TABLE B ADD CONSTRAINT FK_A FOREIGN KEY (AID) REFERENCES A (ID) ON DELETE CASCADE",
+				"CREATE INDEX AByName ON A(Name DESC)",
+			},
+		},
+		"change streams and views": {
+			from: "CREATE TABLE A (ID INT64, Name STRING(MAX)) PRIMARY KEY(ID);\n" +
+				"CREATE CHANGE STREAM S FOR A(Name);\n" +
+				"CREATE VIEW V SQL SECURITY INVOKER AS SELECT A.Name FROM A;",
+			to: "CREATE TABLE A (ID INT64, Title STRING(MAX)) PRIMARY KEY(ID);\n" +
+				"CREATE CHANGE STREAM S FOR A(Title);\n" +
+				"CREATE VIEW V SQL SECURITY INVOKER AS SELECT A.Title FROM A;",
+			statements: []string{
+				"DROP VIEW V",
+				"DROP CHANGE STREAM S",
+				"ALTER TABLE A DROP COLUMN Name",
+				"ALTER TABLE A ADD COLUMN Title STRING(MAX)",
+				"CREATE CHANGE STREAM S FOR A(Title)",
+				"CREATE VIEW V SQL SECURITY INVOKER AS SELECT A.Title FROM A",
+			},
+		},
+		"primary key change": {
+			from:         "CREATE TABLE A (ID INT64, Name STRING(MAX)) PRIMARY KEY(ID);",
+			to:           "CREATE TABLE A (ID INT64, Name STRING(MAX)) PRIMARY KEY(Name);",
+			incompatible: 1,
+		},
+		"migrations": {
+			from: "CREATE TABLE A (ID INT64) PRIMARY KEY(ID);",
+			to: "CREATE TABLE A (ID INT64, Name STRING(MAX)) PRIMARY KEY(ID);\n" +
+				"ALTER TABLE A DROP COLUMN Name;\n" +
+				"ALTER TABLE A ADD COLUMN Title STRING(MAX);\n" +
+				"CREATE INDEX AByTitle ON A(Title);\n" +
+				"DROP INDEX AByTitle;",
+			statements: []string{
+				"ALTER TABLE A ADD COLUMN Title STRING(MAX)",
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			from, err := ParseSchema([]byte(test.from))
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := ParseSchema([]byte(test.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff := DiffSchema(from, to)
+			if len(diff.Statements) != 0 || len(test.statements) != 0 {
+				if !reflect.DeepEqual(diff.Statements, test.statements) {
+					t.Errorf("expected %q but got %q", test.statements, diff.Statements)
+				}
+			}
+			if len(diff.Incompatible) != test.incompatible {
+				t.Errorf("expected %d incompatible changes but got %q", test.incompatible, diff.Incompatible)
+			}
+		})
+	}
+}
+
+func TestParseSchema_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ParseSchema([]byte("CREATE ROLE Reader")); err == nil {
+		t.Error("expected error for unsupported statement but no error")
+	}
+	if _, err := ParseSchema([]byte("ALTER TABLE A ADD COLUMN B INT64")); err == nil {
+		t.Error("expected error for unknown table but no error")
+	}
+}
@@ -2,6 +2,21 @@ package spool
 
 import "errors"
 
+// ErrLeaseLost is returned when the caller no longer holds the checkout of the database.
+var ErrLeaseLost = errors.New("the database is not held by the caller")
+
+// ErrInvalidTransition is returned when the database cannot change to the requested state.
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// ErrPoolFull is returned when a database cannot be created because the pool has reached its maximum size.
+var ErrPoolFull = errors.New("the pool has reached its maximum size")
+
+// ErrInvalidDatabaseName is returned when a database name or its prefix is not a valid Cloud Spanner database ID.
+var ErrInvalidDatabaseName = errors.New("invalid database name")
+
+// ErrNotStuck is returned when a database to recover is not stuck in the creating state.
+var ErrNotStuck = errors.New("the database is not stuck in creating")
+
 type yoError interface {
 	NotFound() bool
 }
@@ -11,8 +11,10 @@ tool (
 )
 
 require (
+	cloud.google.com/go/longrunning v0.6.7
 	cloud.google.com/go/spanner v1.81.1
 	github.com/alecthomas/kingpin v2.2.6+incompatible
+	github.com/cloudspannerecosystem/memefish v0.4.0
 	google.golang.org/api v0.232.0
 	google.golang.org/grpc v1.72.0
 )
@@ -26,7 +28,6 @@ require (
 	cloud.google.com/go/auth/oauth2adapt v0.2.8 // indirect
 	cloud.google.com/go/compute/metadata v0.6.0 // indirect
 	cloud.google.com/go/iam v1.5.2 // indirect
-	cloud.google.com/go/longrunning v0.6.7 // indirect
 	cloud.google.com/go/monitoring v1.24.2 // indirect
 	github.com/4meepo/tagalign v1.4.2 // indirect
 	github.com/Abirdcfly/dupword v0.1.3 // indirect
@@ -65,7 +66,6 @@ require (
 	github.com/charithe/durationcheck v0.0.10 // indirect
 	github.com/chavacava/garif v0.1.0 // indirect
 	github.com/ckaznocha/intrange v0.3.0 // indirect
-	github.com/cloudspannerecosystem/memefish v0.4.0 // indirect
 	github.com/cloudspannerecosystem/wrench v1.11.3 // indirect
 	github.com/cncf/xds/go v0.0.0-20250121191232-2f005788dc42 // indirect
 	github.com/curioswitch/go-reassign v0.3.0 // indirect
@@ -0,0 +1,81 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+// jobIDEnvVars is a list of environment variables which CI services set to identify the running job.
+var jobIDEnvVars = []string{
+	"GITHUB_RUN_ID",
+	"CIRCLE_BUILD_NUM",
+	"BUILDKITE_BUILD_ID",
+	"CI_JOB_ID", // GitLab CI
+}
+
+// Holder represents who checks out a database.
+type Holder struct {
+	Hostname string
+	PID      int64
+	User     string
+	JobID    string
+}
+
+// String returns a string representing the holder such as "user@hostname:pid (job)".
+func (h *Holder) String() string {
+	s := fmt.Sprintf("%s@%s:%d", h.User, h.Hostname, h.PID)
+	if h.JobID != "" {
+		s += fmt.Sprintf(" (%s)", h.JobID)
+	}
+	return s
+}
+
+// currentHolder returns the Holder of the current process.
+// jobID takes precedence over the job ID detected from CI environment variables.
+func currentHolder(jobID string) *Holder {
+	h := &Holder{
+		PID:   int64(os.Getpid()),
+		JobID: jobID,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		h.Hostname = hostname
+	}
+	if u, err := user.Current(); err == nil {
+		h.User = u.Username
+	} else {
+		h.User = os.Getenv("USER")
+	}
+	if h.JobID == "" {
+		for _, name := range jobIDEnvVars {
+			if v := os.Getenv(name); v != "" {
+				h.JobID = v
+				break
+			}
+		}
+	}
+	return h
+}
+
+// HolderOf returns the Holder of sdb, or nil if sdb has no holder.
+func HolderOf(sdb *model.SpoolDatabase) *Holder {
+	if !sdb.HolderHostname.Valid && !sdb.HolderPID.Valid && !sdb.HolderUser.Valid && !sdb.HolderJobID.Valid {
+		return nil
+	}
+	return &Holder{
+		Hostname: sdb.HolderHostname.StringVal,
+		PID:      sdb.HolderPID.Int64,
+		User:     sdb.HolderUser.StringVal,
+		JobID:    sdb.HolderJobID.StringVal,
+	}
+}
+
+func setHolder(sdb *model.SpoolDatabase, h *Holder) {
+	if h == nil {
+		sdb.ChangeHolder("", 0, "", "")
+		return
+	}
+	sdb.ChangeHolder(h.Hostname, h.PID, h.User, h.JobID)
+}
@@ -0,0 +1,71 @@
+package spool
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestCurrentHolder(t *testing.T) {
+	tests := map[string]struct {
+		jobID   string
+		envVars map[string]string
+		expect  string
+	}{
+		"no job": {
+			expect: "",
+		},
+		"from GitHub Actions": {
+			envVars: map[string]string{"GITHUB_RUN_ID": "github-run"},
+			expect:  "github-run",
+		},
+		"from CircleCI": {
+			envVars: map[string]string{"CIRCLE_BUILD_NUM": "circle-build"},
+			expect:  "circle-build",
+		},
+		"from Buildkite": {
+			envVars: map[string]string{"BUILDKITE_BUILD_ID": "buildkite-build"},
+			expect:  "buildkite-build",
+		},
+		"explicit job ID": {
+			jobID:   "job",
+			envVars: map[string]string{"GITHUB_RUN_ID": "github-run"},
+			expect:  "job",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, name := range jobIDEnvVars {
+				t.Setenv(name, "")
+			}
+			for k, v := range test.envVars {
+				t.Setenv(k, v)
+			}
+			h := currentHolder(test.jobID)
+			if got := h.JobID; got != test.expect {
+				t.Errorf("expected job ID %q but got %q", test.expect, got)
+			}
+			if got := h.PID; got != int64(os.Getpid()) {
+				t.Errorf("expected PID %d but got %d", os.Getpid(), got)
+			}
+		})
+	}
+}
+
+func TestHolderOf(t *testing.T) {
+	t.Parallel()
+
+	sdb := &model.SpoolDatabase{}
+	if h := HolderOf(sdb); h != nil {
+		t.Errorf("expected no holder but got %s", h)
+	}
+	setHolder(sdb, &Holder{Hostname: "host", PID: 1, User: "user", JobID: "job"})
+	if expected, got := "user@host:1 (job)", HolderOf(sdb).String(); expected != got {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+	setHolder(sdb, nil)
+	if h := HolderOf(sdb); h != nil {
+		t.Errorf("expected no holder but got %s", h)
+	}
+}
@@ -8,6 +8,25 @@ CREATE TABLE SpoolDatabases (
   UpdatedAt TIMESTAMP NOT NULL OPTIONS (
     allow_commit_timestamp = true
   ),
+  LeaseExpiresAt TIMESTAMP,
+  CheckoutToken STRING(MAX),
+  HolderHostname STRING(MAX),
+  HolderPID INT64,
+  HolderUser STRING(MAX),
+  HolderJobID STRING(MAX),
+  MigrationVersion INT64,
+  OperationName STRING(MAX),
 ) PRIMARY KEY(DatabaseName);
 
 CREATE INDEX SpoolDatabasesByChecksumAndState ON SpoolDatabases(Checksum, State);
+
+CREATE TABLE SpoolWaiters (
+  Checksum STRING(MAX) NOT NULL,
+  WaiterID STRING(MAX) NOT NULL,
+  CreatedAt TIMESTAMP NOT NULL OPTIONS (
+    allow_commit_timestamp = true
+  ),
+  HeartbeatAt TIMESTAMP NOT NULL OPTIONS (
+    allow_commit_timestamp = true
+  ),
+) PRIMARY KEY(Checksum, WaiterID);
@@ -24,7 +24,7 @@ func spoolSpannerDatabaseNamePrefix() string {
 	return s
 }
 
-func ConfigTestDatabase(t *testing.T) *Config {
+func ConfigTestDatabase(t testing.TB) *Config {
 	t.Helper()
 
 	emulatorHost := os.Getenv("SPANNER_EMULATOR_HOST")
@@ -47,7 +47,7 @@ func ConfigTestDatabase(t *testing.T) *Config {
 	return cfg
 }
 
-func SetupTestDatabase(t *testing.T) *Config {
+func SetupTestDatabase(t testing.TB) *Config {
 	t.Helper()
 
 	ctx := context.Background()
@@ -60,3 +60,13 @@ func SetupTestDatabase(t *testing.T) *Config {
 
 	return cfg
 }
+
+func ddlChecksum(t *testing.T, ddl []byte) string {
+	t.Helper()
+
+	normalized, err := NormalizeDDL(ddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Checksum(normalized, nil)
+}
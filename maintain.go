@@ -0,0 +1,65 @@
+package spool
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+// errIdleEnough is returned by create with minIdle when the pool already has enough idle or creating databases.
+var errIdleEnough = errors.New("the pool has enough idle databases")
+
+// Maintain creates databases until the pool has the minimum number of idle databases set by WithMinIdle.
+// Databases being created by others count as idle, and each creation is reserved only if the pool is still short
+// in the same transaction, so concurrent maintainers never create more than the minimum in total.
+// It stops without an error when the pool reaches its maximum size.
+// It returns the created databases.
+func (p *Pool) Maintain(ctx context.Context) ([]*model.SpoolDatabase, error) {
+	created := []*model.SpoolDatabase{}
+	for range p.minIdle {
+		sdb, err := p.create(ctx, p.minIdlePrefix, StateIdle, currentHolder(""), 0, p.minIdle)
+		if errors.Is(err, errIdleEnough) || errors.Is(err, ErrPoolFull) {
+			break
+		}
+		if err != nil {
+			return created, err
+		}
+		created = append(created, sdb)
+	}
+	return created, nil
+}
+
+// maintainInBackground starts Maintain in a goroutine unless it is already running.
+// The maintenance continues after ctx is canceled; call Wait to wait for it.
+func (p *Pool) maintainInBackground(ctx context.Context) {
+	if p.minIdle <= 0 {
+		return
+	}
+	m := &p.maintenance
+	m.Lock()
+	defer m.Unlock()
+	if m.running {
+		return
+	}
+	m.running = true
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		_, err := p.Maintain(context.WithoutCancel(ctx))
+		m.Lock()
+		defer m.Unlock()
+		m.running = false
+		m.err = err
+	}()
+}
+
+// Wait waits for the background maintenance started by Get and returns its error.
+// Databases being created are leaked if the process exits before the maintenance finishes.
+func (p *Pool) Wait() error {
+	m := &p.maintenance
+	m.wg.Wait()
+	m.Lock()
+	defer m.Unlock()
+	return m.err
+}
@@ -0,0 +1,87 @@
+package spool
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestPool_Maintain(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	sdbs, err := pool.Maintain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sdbs) != 0 {
+		t.Errorf("expected no databases without min idle but got %d", len(sdbs))
+	}
+
+	pool, err = NewPool(ctx, cfg, ddl1, WithMinIdle(1, spoolSpannerDatabaseNamePrefix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdbs, err = pool.Maintain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sdbs) != 1 {
+		t.Fatalf("expected 1 database but got %d", len(sdbs))
+	}
+	sdbs, err = pool.Maintain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sdbs) != 0 {
+		t.Errorf("expected no databases when the pool has enough idle databases but got %d", len(sdbs))
+	}
+}
+
+func TestPool_MaintainConcurrently(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	// Each process maintains the pool on its own.
+	const minIdle, maintainers = 2, 3
+	var wg sync.WaitGroup
+	errs := make([]error, maintainers)
+	for i := range maintainers {
+		pool, err := NewPool(ctx, cfg, ddl1, WithMinIdle(minIdle, spoolSpannerDatabaseNamePrefix()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = pool.Maintain(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sdbs, err := model.FindSpoolDatabasesByChecksumState(ctx, client.Single(), ddlChecksum(t, ddl1), StateIdle.Int64())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sdbs) != minIdle {
+		t.Errorf("expected %d idle databases but got %d", minIdle, len(sdbs))
+	}
+}
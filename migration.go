@@ -0,0 +1,169 @@
+package spool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// schemaMigrationsTable is the version table used by wrench and golang-migrate.
+const schemaMigrationsTable = "SchemaMigrations"
+
+const schemaMigrationsDDL = "CREATE TABLE " + schemaMigrationsTable + " (\n" +
+	"  Version INT64 NOT NULL,\n" +
+	"  Dirty BOOL NOT NULL,\n" +
+	") PRIMARY KEY(Version)"
+
+// migrationFileRegexp matches migration file names such as 000001.sql and 000001_create_books.up.sql.
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)(?:_[^.]*)?(?:\.up)?\.sql$`)
+
+// Migration represents a numbered migration file.
+type Migration struct {
+	Version int64
+	Name    string
+	DDL     []byte
+}
+
+// LoadMigrations loads migration files in dir ordered by their version prefix.
+// Down migrations (*.down.sql) are ignored.
+func LoadMigrations(dir string) ([]*Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	migrations := []*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".sql" || strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+		m := migrationFileRegexp.FindStringSubmatch(name)
+		if m == nil {
+			return nil, fmt.Errorf("%s: migration file name must start with a version number", filepath.Join(dir, name))
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, name), err)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name)) // #nosec G304 -- reading the given migration file is intended
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, &Migration{Version: version, Name: name, DDL: b})
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migration files in %s", dir)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrationsDDL concatenates the migrations in order followed by the SchemaMigrations table.
+func MigrationsDDL(migrations []*Migration) []byte {
+	var b bytes.Buffer
+	for _, m := range migrations {
+		b.Write(m.DDL)
+		// Terminate the last statement of the file in case it lacks a semicolon.
+		b.WriteString("\n;\n")
+	}
+	b.WriteString(schemaMigrationsDDL)
+	b.WriteString(";\n")
+	return b.Bytes()
+}
+
+// dmlKeywords are the first keywords of DML statements.
+var dmlKeywords = []string{"INSERT", "UPDATE", "DELETE"}
+
+// checkMigrations returns an error if a migration has a DML statement.
+// The migrations are applied as the DDL of a new database, which cannot contain DML.
+func checkMigrations(migrations []*Migration) error {
+	for _, m := range migrations {
+		stmts, err := ddlToStatements(m.DDL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Name, err)
+		}
+		for _, stmt := range stmts {
+			if fields := strings.Fields(stmt); len(fields) > 0 && slices.Contains(dmlKeywords, strings.ToUpper(fields[0])) {
+				return fmt.Errorf("%s: DML is not supported in migrations, load the data with --seed instead: %s", m.Name, stmt)
+			}
+		}
+	}
+	return nil
+}
+
+// withMigrations makes the pool stamp the latest version into the SchemaMigrations table of each database
+// and upgrade databases made from earlier versions of the migrations.
+func withMigrations(migrations []*Migration) Option {
+	return func(p *Pool) {
+		p.migrations = migrations
+	}
+}
+
+// NewPoolFromMigrations creates a new Pool whose schema is the migrations applied in order.
+// Each database has the SchemaMigrations table holding the latest version,
+// so that wrench and golang-migrate regard it as up to date.
+// Migrations must consist of DDL, since they are applied when databases are created.
+func NewPoolFromMigrations(ctx context.Context, conf *Config, migrations []*Migration, opts ...Option) (*Pool, error) {
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations")
+	}
+	if err := checkMigrations(migrations); err != nil {
+		return nil, err
+	}
+	opts = append(opts, withMigrations(migrations))
+	return NewPool(ctx, conf, MigrationsDDL(migrations), opts...)
+}
+
+// previousChecksums returns the checksums of databases made from each earlier version of the migrations.
+func previousChecksums(migrations []*Migration, seed *Seed) (map[string]int64, error) {
+	checksums := map[string]int64{}
+	for i := 1; i < len(migrations); i++ {
+		normalized, err := NormalizeDDL(MigrationsDDL(migrations[:i]))
+		if err != nil {
+			return nil, err
+		}
+		checksums[Checksum(normalized, seed)] = migrations[i-1].Version
+	}
+	return checksums, nil
+}
+
+// pendingStatements returns the statements of the migrations newer than version.
+func pendingStatements(migrations []*Migration, version int64) ([]string, error) {
+	stmts := []string{}
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		s, err := ddlToStatements(m.DDL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Name, err)
+		}
+		stmts = append(stmts, s...)
+	}
+	return stmts, nil
+}
+
+// stampMigrationVersion records the version as the only applied version in the SchemaMigrations table.
+func stampMigrationVersion(ctx context.Context, client *spanner.Client, version int64) error {
+	_, err := client.Apply(ctx, []*spanner.Mutation{
+		spanner.Delete(schemaMigrationsTable, spanner.AllKeys()),
+		spanner.Insert(schemaMigrationsTable, []string{"Version", "Dirty"}, []interface{}{version, false}),
+	})
+	return err
+}
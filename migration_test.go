@@ -0,0 +1,206 @@
+package spool
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := LoadMigrations("testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []int64{}
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	if expected := []int64{1, 2}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected %v but got %v", expected, versions)
+	}
+
+	stmts, err := ddlToStatements(MigrationsDDL(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements but got %q", stmts)
+	}
+	if stmts[1] != "ALTER TABLE Books ADD COLUMN Title STRING(MAX)" {
+		t.Errorf("unexpected statement: %q", stmts[1])
+	}
+	if stmts[2] != schemaMigrationsDDL {
+		t.Errorf("expected the version table but got %q", stmts[2])
+	}
+
+	if _, err := LoadMigrations("testdata/seed"); err == nil {
+		t.Error("expected error for a directory without migration files but no error")
+	}
+}
+
+func TestNewPoolFromMigrations_DML(t *testing.T) {
+	t.Parallel()
+
+	create := &Migration{Version: 1, Name: "000001.sql", DDL: []byte("CREATE TABLE Books (ISBN STRING(20) NOT NULL) PRIMARY KEY(ISBN);")}
+	tests := map[string]string{
+		"insert": "INSERT INTO Books (ISBN) VALUES ('isbn');",
+		"update": "ALTER TABLE Books ADD COLUMN Title STRING(MAX);\nupdate Books SET Title = '' WHERE true;",
+		"delete": "DELETE FROM Books WHERE true;",
+	}
+	for name, ddl := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			migrations := []*Migration{create, {Version: 2, Name: "000002.sql", DDL: []byte(ddl)}}
+			_, err := NewPoolFromMigrations(context.Background(), &Config{}, migrations)
+			if err == nil || !strings.Contains(err.Error(), "000002.sql: DML is not supported") {
+				t.Errorf("expected an error for DML in 000002.sql but got %v", err)
+			}
+		})
+	}
+
+	migrations, err := LoadMigrations("testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMigrations(migrations); err != nil {
+		t.Errorf("unexpected error for DDL migrations: %s", err)
+	}
+}
+
+func TestPool_CreateFromMigrations(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	migrations, err := LoadMigrations("testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewPoolFromMigrations(ctx, cfg, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := spanner.NewClient(ctx, cfg.WithDatabaseID(sdb.DatabaseName).Database(), cfg.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.Insert("Books", []string{"ISBN", "Title"}, []interface{}{"isbn", "title"})}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+	if err := resetDatabase(ctx, client, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var version int64
+	var dirty bool
+	if err := client.Single().Query(ctx, spanner.NewStatement("SELECT Version, Dirty FROM SchemaMigrations")).Do(func(row *spanner.Row) error {
+		return row.Columns(&version, &dirty)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 || dirty {
+		t.Errorf("expected version 2 and not dirty after reset but got %d, %t", version, dirty)
+	}
+}
+
+func TestPreviousChecksums(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := LoadMigrations("testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksums, err := previousChecksums(migrations, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checksums) != 1 {
+		t.Fatalf("expected 1 checksum but got %d", len(checksums))
+	}
+	if v, ok := checksums[ddlChecksum(t, MigrationsDDL(migrations[:1]))]; !ok || v != 1 {
+		t.Errorf("expected version 1 for the first migration but got %d", v)
+	}
+
+	stmts, err := pendingStatements(migrations, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ALTER TABLE Books ADD COLUMN Title STRING(MAX)"}; !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("expected %q but got %q", expected, stmts)
+	}
+}
+
+func TestPool_GetUpgrade(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	migrations, err := LoadMigrations("testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPool, err := NewPoolFromMigrations(ctx, cfg, migrations[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := oldPool.Create(ctx, spoolSpannerDatabaseNamePrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := NewPoolFromMigrations(ctx, cfg, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdb.DatabaseName != created.DatabaseName {
+		t.Errorf("expected %s to be upgraded but got %s", created.DatabaseName, sdb.DatabaseName)
+	}
+	if sdb.Checksum != pool.checksum {
+		t.Errorf("expected checksum %s but got %s", pool.checksum, sdb.Checksum)
+	}
+	if sdb.MigrationVersion.Int64 != 2 {
+		t.Errorf("expected migration version 2 but got %v", sdb.MigrationVersion)
+	}
+
+	client, err := spanner.NewClient(ctx, cfg.WithDatabaseID(sdb.DatabaseName).Database(), cfg.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.Insert("Books", []string{"ISBN", "Title"}, []interface{}{"isbn", "title"})}); err != nil {
+		t.Errorf("expected the pending migration to be applied: %s", err)
+	}
+	var version int64
+	if err := client.Single().Query(ctx, spanner.NewStatement("SELECT Version FROM SchemaMigrations")).Do(func(row *spanner.Row) error {
+		return row.Columns(&version)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("expected version 2 but got %d", version)
+	}
+}
@@ -14,11 +14,19 @@ import (
 
 // SpoolDatabase represents a row from 'SpoolDatabases'.
 type SpoolDatabase struct {
-	DatabaseName string    `spanner:"DatabaseName" json:"DatabaseName"` // DatabaseName
-	Checksum     string    `spanner:"Checksum" json:"Checksum"`         // Checksum
-	State        int64     `spanner:"State" json:"State"`               // State
-	CreatedAt    time.Time `spanner:"CreatedAt" json:"CreatedAt"`       // CreatedAt
-	UpdatedAt    time.Time `spanner:"UpdatedAt" json:"UpdatedAt"`       // UpdatedAt
+	DatabaseName     string             `spanner:"DatabaseName" json:"DatabaseName"`         // DatabaseName
+	Checksum         string             `spanner:"Checksum" json:"Checksum"`                 // Checksum
+	State            int64              `spanner:"State" json:"State"`                       // State
+	CreatedAt        time.Time          `spanner:"CreatedAt" json:"CreatedAt"`               // CreatedAt
+	UpdatedAt        time.Time          `spanner:"UpdatedAt" json:"UpdatedAt"`               // UpdatedAt
+	LeaseExpiresAt   spanner.NullTime   `spanner:"LeaseExpiresAt" json:"LeaseExpiresAt"`     // LeaseExpiresAt
+	CheckoutToken    spanner.NullString `spanner:"CheckoutToken" json:"CheckoutToken"`       // CheckoutToken
+	HolderHostname   spanner.NullString `spanner:"HolderHostname" json:"HolderHostname"`     // HolderHostname
+	HolderPID        spanner.NullInt64  `spanner:"HolderPID" json:"HolderPID"`               // HolderPID
+	HolderUser       spanner.NullString `spanner:"HolderUser" json:"HolderUser"`             // HolderUser
+	HolderJobID      spanner.NullString `spanner:"HolderJobID" json:"HolderJobID"`           // HolderJobID
+	MigrationVersion spanner.NullInt64  `spanner:"MigrationVersion" json:"MigrationVersion"` // MigrationVersion
+	OperationName    spanner.NullString `spanner:"OperationName" json:"OperationName"`       // OperationName
 }
 
 func SpoolDatabasePrimaryKeys() []string {
@@ -34,6 +42,14 @@ func SpoolDatabaseColumns() []string {
 		"State",
 		"CreatedAt",
 		"UpdatedAt",
+		"LeaseExpiresAt",
+		"CheckoutToken",
+		"HolderHostname",
+		"HolderPID",
+		"HolderUser",
+		"HolderJobID",
+		"MigrationVersion",
+		"OperationName",
 	}
 }
 
@@ -56,6 +72,22 @@ func (sd *SpoolDatabase) columnsToPtrs(cols []string, customPtrs map[string]inte
 			ret = append(ret, &sd.CreatedAt)
 		case "UpdatedAt":
 			ret = append(ret, &sd.UpdatedAt)
+		case "LeaseExpiresAt":
+			ret = append(ret, &sd.LeaseExpiresAt)
+		case "CheckoutToken":
+			ret = append(ret, &sd.CheckoutToken)
+		case "HolderHostname":
+			ret = append(ret, &sd.HolderHostname)
+		case "HolderPID":
+			ret = append(ret, &sd.HolderPID)
+		case "HolderUser":
+			ret = append(ret, &sd.HolderUser)
+		case "HolderJobID":
+			ret = append(ret, &sd.HolderJobID)
+		case "MigrationVersion":
+			ret = append(ret, &sd.MigrationVersion)
+		case "OperationName":
+			ret = append(ret, &sd.OperationName)
 		default:
 			return nil, fmt.Errorf("unknown column: %s", col)
 		}
@@ -77,6 +109,22 @@ func (sd *SpoolDatabase) columnsToValues(cols []string) ([]interface{}, error) {
 			ret = append(ret, sd.CreatedAt)
 		case "UpdatedAt":
 			ret = append(ret, sd.UpdatedAt)
+		case "LeaseExpiresAt":
+			ret = append(ret, sd.LeaseExpiresAt)
+		case "CheckoutToken":
+			ret = append(ret, sd.CheckoutToken)
+		case "HolderHostname":
+			ret = append(ret, sd.HolderHostname)
+		case "HolderPID":
+			ret = append(ret, sd.HolderPID)
+		case "HolderUser":
+			ret = append(ret, sd.HolderUser)
+		case "HolderJobID":
+			ret = append(ret, sd.HolderJobID)
+		case "MigrationVersion":
+			ret = append(ret, sd.MigrationVersion)
+		case "OperationName":
+			ret = append(ret, sd.OperationName)
 		default:
 			return nil, fmt.Errorf("unknown column: %s", col)
 		}
@@ -109,7 +157,7 @@ func newSpoolDatabase_Decoder(cols []string) func(*spanner.Row) (*SpoolDatabase,
 // exists, the write or transaction fails.
 func (sd *SpoolDatabase) Insert(ctx context.Context) *spanner.Mutation {
 	return spanner.Insert("SpoolDatabases", SpoolDatabaseColumns(), []interface{}{
-		sd.DatabaseName, sd.Checksum, sd.State, sd.CreatedAt, sd.UpdatedAt,
+		sd.DatabaseName, sd.Checksum, sd.State, sd.CreatedAt, sd.UpdatedAt, sd.LeaseExpiresAt, sd.CheckoutToken, sd.HolderHostname, sd.HolderPID, sd.HolderUser, sd.HolderJobID, sd.MigrationVersion, sd.OperationName,
 	})
 }
 
@@ -117,7 +165,7 @@ func (sd *SpoolDatabase) Insert(ctx context.Context) *spanner.Mutation {
 // already exist, the write or transaction fails.
 func (sd *SpoolDatabase) Update(ctx context.Context) *spanner.Mutation {
 	return spanner.Update("SpoolDatabases", SpoolDatabaseColumns(), []interface{}{
-		sd.DatabaseName, sd.Checksum, sd.State, sd.CreatedAt, sd.UpdatedAt,
+		sd.DatabaseName, sd.Checksum, sd.State, sd.CreatedAt, sd.UpdatedAt, sd.LeaseExpiresAt, sd.CheckoutToken, sd.HolderHostname, sd.HolderPID, sd.HolderUser, sd.HolderJobID, sd.MigrationVersion, sd.OperationName,
 	})
 }
 
@@ -126,7 +174,7 @@ func (sd *SpoolDatabase) Update(ctx context.Context) *spanner.Mutation {
 // written are preserved.
 func (sd *SpoolDatabase) InsertOrUpdate(ctx context.Context) *spanner.Mutation {
 	return spanner.InsertOrUpdate("SpoolDatabases", SpoolDatabaseColumns(), []interface{}{
-		sd.DatabaseName, sd.Checksum, sd.State, sd.CreatedAt, sd.UpdatedAt,
+		sd.DatabaseName, sd.Checksum, sd.State, sd.CreatedAt, sd.UpdatedAt, sd.LeaseExpiresAt, sd.CheckoutToken, sd.HolderHostname, sd.HolderPID, sd.HolderUser, sd.HolderJobID, sd.MigrationVersion, sd.OperationName,
 	})
 }
 
@@ -171,7 +219,7 @@ func (sd *SpoolDatabase) Delete(ctx context.Context) *spanner.Mutation {
 // Generated from index 'SpoolDatabasesByChecksumAndState'.
 func FindSpoolDatabasesByChecksumState(ctx context.Context, db YORODB, checksum string, state int64) ([]*SpoolDatabase, error) {
 	const sqlstr = `SELECT ` +
-		`DatabaseName, Checksum, State, CreatedAt, UpdatedAt ` +
+		`DatabaseName, Checksum, State, CreatedAt, UpdatedAt, LeaseExpiresAt, CheckoutToken, HolderHostname, HolderPID, HolderUser, HolderJobID, MigrationVersion, OperationName ` +
 		`FROM SpoolDatabases@{FORCE_INDEX=SpoolDatabasesByChecksumAndState} ` +
 		`WHERE Checksum = @param0 AND State = @param1`
 
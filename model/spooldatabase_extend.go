@@ -2,6 +2,7 @@ package model
 
 import (
 	"context"
+	"time"
 
 	"cloud.google.com/go/spanner"
 	"google.golang.org/api/iterator"
@@ -13,6 +14,72 @@ func (sdb *SpoolDatabase) ChangeState(state int64) {
 	sdb.UpdatedAt = spanner.CommitTimestamp
 }
 
+// ChangeLease sets the lease of sdb to expire after d from now.
+// now must be the time of Cloud Spanner returned by CurrentTimestamp, because leases are compared
+// with CURRENT_TIMESTAMP() and the clock of the host may be skewed.
+// If d is zero or negative, the lease is cleared and never expires.
+func (sdb *SpoolDatabase) ChangeLease(now time.Time, d time.Duration) {
+	if d <= 0 {
+		sdb.ClearLease()
+		return
+	}
+	sdb.LeaseExpiresAt = spanner.NullTime{Time: now.Add(d), Valid: true}
+}
+
+// ClearLease clears the lease of sdb so that it never expires.
+func (sdb *SpoolDatabase) ClearLease() {
+	sdb.LeaseExpiresAt = spanner.NullTime{}
+}
+
+// ChangeCheckoutToken sets the checkout token of sdb.
+// If token is empty, the checkout token is cleared.
+func (sdb *SpoolDatabase) ChangeCheckoutToken(token string) {
+	sdb.CheckoutToken = spanner.NullString{StringVal: token, Valid: token != ""}
+}
+
+// ChangeHolder sets the holder of sdb. Empty values are stored as NULL.
+func (sdb *SpoolDatabase) ChangeHolder(hostname string, pid int64, user, jobID string) {
+	sdb.HolderHostname = spanner.NullString{StringVal: hostname, Valid: hostname != ""}
+	sdb.HolderPID = spanner.NullInt64{Int64: pid, Valid: pid != 0}
+	sdb.HolderUser = spanner.NullString{StringVal: user, Valid: user != ""}
+	sdb.HolderJobID = spanner.NullString{StringVal: jobID, Valid: jobID != ""}
+}
+
+// ChangeSchema sets the checksum of sdb and the migration version it has been migrated to.
+// If version is zero, the migration version is cleared.
+func (sdb *SpoolDatabase) ChangeSchema(checksum string, version int64) {
+	sdb.Checksum = checksum
+	sdb.MigrationVersion = spanner.NullInt64{Int64: version, Valid: version != 0}
+	sdb.UpdatedAt = spanner.CommitTimestamp
+}
+
+// HeldBy reports whether sdb is checked out with token.
+func (sdb *SpoolDatabase) HeldBy(token string) bool {
+	return sdb.CheckoutToken.Valid && sdb.CheckoutToken.StringVal == token
+}
+
+// LeaseExpired reports whether the lease of sdb has expired at t.
+func (sdb *SpoolDatabase) LeaseExpired(t time.Time) bool {
+	return sdb.LeaseExpiresAt.Valid && !sdb.LeaseExpiresAt.Time.After(t)
+}
+
+// CurrentTimestamp returns the current time of Cloud Spanner.
+func CurrentTimestamp(ctx context.Context, db YORODB) (time.Time, error) {
+	const sqlstr = `SELECT CURRENT_TIMESTAMP()`
+
+	stmt := spanner.NewStatement(sqlstr)
+
+	// run query
+	YOLog(ctx, sqlstr)
+	var now time.Time
+	if err := db.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		return row.Columns(&now)
+	}); err != nil {
+		return time.Time{}, newError("CurrentTimestamp", "SpoolDatabases", err)
+	}
+	return now, nil
+}
+
 // FindAllSpoolDatabases finds all SpoolDatabases.
 func FindAllSpoolDatabases(ctx context.Context, db YORODB) ([]*SpoolDatabase, error) {
 	const sqlstr = `SELECT ` +
@@ -98,6 +165,9 @@ func FindSpoolDatabasesByChecksum(ctx context.Context, db YORODB, checksum strin
 }
 
 // FindSpoolDatabaseByChecksumState finds a SpoolDatabase by Checksum and State.
+//
+// Deprecated: Pool no longer uses it, because concurrent callers get the same row and contend on it.
+// Use FindAvailableSpoolDatabasesByChecksums to get candidates in a shuffled order.
 func FindSpoolDatabaseByChecksumState(ctx context.Context, db YORODB, checksum string, state int64) (*SpoolDatabase, error) {
 	const sqlstr = `SELECT ` +
 		`*` +
@@ -134,3 +204,134 @@ func FindSpoolDatabaseByChecksumState(ctx context.Context, db YORODB, checksum s
 
 	return &sd, nil
 }
+
+// CountSpoolDatabases counts SpoolDatabases which are not in the excluded state.
+// If checksum is not empty, only SpoolDatabases with the checksum are counted.
+func CountSpoolDatabases(ctx context.Context, db YORODB, checksum string, excluded int64) (int64, error) {
+	sqlstr := `SELECT ` +
+		`COUNT(*) ` +
+		`FROM SpoolDatabases ` +
+		`WHERE State != @param0`
+	params := map[string]interface{}{"param0": excluded}
+	if checksum != "" {
+		sqlstr += ` AND Checksum = @param1`
+		params["param1"] = checksum
+	}
+
+	stmt := spanner.Statement{SQL: sqlstr, Params: params}
+
+	// run query
+	YOLog(ctx, sqlstr, excluded, checksum)
+	var count int64
+	if err := db.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	}); err != nil {
+		return 0, newError("CountSpoolDatabases", "SpoolDatabases", err)
+	}
+	return count, nil
+}
+
+// CountAvailableSpoolDatabasesByChecksums counts SpoolDatabases by one of checksums which are idle or whose lease has expired.
+func CountAvailableSpoolDatabasesByChecksums(ctx context.Context, db YORODB, checksums []string, idle, busy int64) (int64, error) {
+	const sqlstr = `SELECT ` +
+		`COUNT(*) ` +
+		`FROM SpoolDatabases@{FORCE_INDEX=SpoolDatabasesByChecksumAndState} ` +
+		`WHERE Checksum IN UNNEST(@param0) AND (State = @param1 OR (State = @param2 AND LeaseExpiresAt <= CURRENT_TIMESTAMP()))`
+
+	stmt := spanner.NewStatement(sqlstr)
+	stmt.Params["param0"] = checksums
+	stmt.Params["param1"] = idle
+	stmt.Params["param2"] = busy
+
+	// run query
+	YOLog(ctx, sqlstr, checksums, idle, busy)
+	var count int64
+	if err := db.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	}); err != nil {
+		return 0, newError("CountAvailableSpoolDatabasesByChecksums", "SpoolDatabases", err)
+	}
+	return count, nil
+}
+
+// CountIdleOrCreatingSpoolDatabases counts SpoolDatabases with checksum which are idle, or creating and whose lease has not expired.
+func CountIdleOrCreatingSpoolDatabases(ctx context.Context, db YORODB, checksum string, idle, creating int64) (int64, error) {
+	const sqlstr = `SELECT ` +
+		`COUNT(*) ` +
+		`FROM SpoolDatabases@{FORCE_INDEX=SpoolDatabasesByChecksumAndState} ` +
+		`WHERE Checksum = @param0 AND (State = @param1 OR (State = @param2 AND LeaseExpiresAt > CURRENT_TIMESTAMP()))`
+
+	stmt := spanner.NewStatement(sqlstr)
+	stmt.Params["param0"] = checksum
+	stmt.Params["param1"] = idle
+	stmt.Params["param2"] = creating
+
+	// run query
+	YOLog(ctx, sqlstr, checksum, idle, creating)
+	var count int64
+	if err := db.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	}); err != nil {
+		return 0, newError("CountIdleOrCreatingSpoolDatabases", "SpoolDatabases", err)
+	}
+	return count, nil
+}
+
+// FindAvailableSpoolDatabasesByChecksums finds up to limit SpoolDatabases by one of checksums which are idle or whose lease has expired.
+// Databases with the latest MigrationVersion come first, and those of the same version are shuffled by salt
+// so that concurrent callers with different salts start from different databases.
+func FindAvailableSpoolDatabasesByChecksums(ctx context.Context, db YORODB, checksums []string, idle, busy int64, salt string, limit int64) ([]*SpoolDatabase, error) {
+	const sqlstr = `SELECT ` +
+		`* ` +
+		`FROM SpoolDatabases@{FORCE_INDEX=SpoolDatabasesByChecksumAndState} ` +
+		`WHERE Checksum IN UNNEST(@param0) AND (State = @param1 OR (State = @param2 AND LeaseExpiresAt <= CURRENT_TIMESTAMP())) ` +
+		`ORDER BY MigrationVersion DESC, FARM_FINGERPRINT(CONCAT(DatabaseName, @param3)) Limit @param4`
+
+	stmt := spanner.NewStatement(sqlstr)
+	stmt.Params["param0"] = checksums
+	stmt.Params["param1"] = idle
+	stmt.Params["param2"] = busy
+	stmt.Params["param3"] = salt
+	stmt.Params["param4"] = limit
+	customPtrs := make(map[string]interface{}, 0)
+
+	// run query
+	YOLog(ctx, sqlstr, checksums, idle, busy, salt, limit)
+	iter := db.Query(ctx, stmt)
+	defer iter.Stop()
+
+	// load results
+	res := []*SpoolDatabase{}
+	for {
+		row, err := iter.Next()
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, newError("FindAvailableSpoolDatabasesByChecksums", "SpoolDatabases", err)
+		}
+
+		var sd SpoolDatabase
+		ptrs, err := sd.columnsToPtrs(SpoolDatabaseColumns(), customPtrs)
+		if err != nil {
+			return nil, newError("FindAvailableSpoolDatabasesByChecksums", "SpoolDatabases", err)
+		}
+
+		if err := row.Columns(ptrs...); err != nil {
+			return nil, newErrorWithCode(codes.Internal, "FindAvailableSpoolDatabasesByChecksums", "SpoolDatabases", err)
+		}
+
+		res = append(res, &sd)
+	}
+	if len(res) == 0 {
+		return nil, newErrorWithCode(codes.NotFound, "FindAvailableSpoolDatabasesByChecksums", "SpoolDatabases", iterator.Done)
+	}
+
+	return res, nil
+}
+
+// ChangeOperationName sets the name of the long-running operation creating sdb.
+// If name is empty, the operation name is cleared.
+func (sdb *SpoolDatabase) ChangeOperationName(name string) {
+	sdb.OperationName = spanner.NullString{StringVal: name, Valid: name != ""}
+}
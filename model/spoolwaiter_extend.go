@@ -0,0 +1,53 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// CountSpoolWaitersAhead counts SpoolWaiters with checksum which started waiting before the waiter
+// identified by createdAt and waiterID. Waiters whose last heartbeat was stale ago or earlier are not counted.
+func CountSpoolWaitersAhead(ctx context.Context, db YORODB, checksum string, createdAt time.Time, waiterID string, stale time.Duration) (int64, error) {
+	const sqlstr = `SELECT ` +
+		`COUNT(*) ` +
+		`FROM SpoolWaiters ` +
+		`WHERE Checksum = @param0 AND HeartbeatAt > TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @param3 MILLISECOND) ` +
+		`AND (CreatedAt < @param1 OR (CreatedAt = @param1 AND WaiterID < @param2))`
+
+	stmt := spanner.NewStatement(sqlstr)
+	stmt.Params["param0"] = checksum
+	stmt.Params["param1"] = createdAt
+	stmt.Params["param2"] = waiterID
+	stmt.Params["param3"] = stale.Milliseconds()
+
+	// run query
+	YOLog(ctx, sqlstr, checksum, createdAt, waiterID, stale)
+	var count int64
+	if err := db.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	}); err != nil {
+		return 0, newError("CountSpoolWaitersAhead", "SpoolWaiters", err)
+	}
+	return count, nil
+}
+
+// DeleteStaleSpoolWaiters deletes SpoolWaiters with checksum whose last heartbeat was stale ago or earlier.
+func DeleteStaleSpoolWaiters(ctx context.Context, txn *spanner.ReadWriteTransaction, checksum string, stale time.Duration) (int64, error) {
+	const sqlstr = `DELETE ` +
+		`FROM SpoolWaiters ` +
+		`WHERE Checksum = @param0 AND HeartbeatAt <= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @param1 MILLISECOND)`
+
+	stmt := spanner.NewStatement(sqlstr)
+	stmt.Params["param0"] = checksum
+	stmt.Params["param1"] = stale.Milliseconds()
+
+	// run query
+	YOLog(ctx, sqlstr, checksum, stale)
+	count, err := txn.Update(ctx, stmt)
+	if err != nil {
+		return 0, newError("DeleteStaleSpoolWaiters", "SpoolWaiters", err)
+	}
+	return count, nil
+}
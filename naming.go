@@ -0,0 +1,199 @@
+package spool
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDatabaseIDLength is the maximum length of a Cloud Spanner database ID.
+	maxDatabaseIDLength = 30
+	// databaseNameSuffixLength is the length of the random suffix placed by {rand}.
+	databaseNameSuffixLength = 8
+	// MaxDatabaseNamePrefixLength is the maximum length of the prefix with DefaultNameTemplate.
+	MaxDatabaseNamePrefixLength = maxDatabaseIDLength - 1 - databaseNameSuffixLength
+	// shortChecksumLength is the length of the checksum placed by {checksum8}.
+	shortChecksumLength = 8
+)
+
+// DefaultNameTemplate is the name template used unless WithNameTemplate is set.
+const DefaultNameTemplate = "{prefix}-{rand}"
+
+// databaseIDRegexp matches Cloud Spanner database IDs: lowercase letters, digits, hyphens and underscores,
+// starting with a letter and not ending with a hyphen or underscore.
+var databaseIDRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]*[a-z0-9]$`)
+
+// databaseNamePrefixRegexp matches prefixes which make valid database IDs with a suffix.
+var databaseNamePrefixRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// invalidDatabaseIDCharsRegexp matches runs of characters which cannot appear in database IDs.
+var invalidDatabaseIDCharsRegexp = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// nameTemplatePlaceholderRegexp matches the placeholders of a name template.
+var nameTemplatePlaceholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+const databaseNameSuffixChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// ValidateDatabaseNamePrefix checks that names made from prefix with DefaultNameTemplate are valid Cloud Spanner database IDs.
+func ValidateDatabaseNamePrefix(prefix string) error {
+	if err := validatePrefixChars(prefix); err != nil {
+		return err
+	}
+	if len(prefix) > MaxDatabaseNamePrefixLength {
+		return fmt.Errorf("%w: prefix %q must be at most %d characters", ErrInvalidDatabaseName, prefix, MaxDatabaseNamePrefixLength)
+	}
+	return nil
+}
+
+func validatePrefixChars(prefix string) error {
+	if !databaseNamePrefixRegexp.MatchString(prefix) {
+		return fmt.Errorf("%w: prefix %q must start with a lowercase letter and contain only lowercase letters, digits, hyphens and underscores", ErrInvalidDatabaseName, prefix)
+	}
+	return nil
+}
+
+// validateDatabaseID checks that id is a valid Cloud Spanner database ID.
+func validateDatabaseID(id string) error {
+	if len(id) < 2 || len(id) > maxDatabaseIDLength || !databaseIDRegexp.MatchString(id) {
+		return fmt.Errorf("%w: %q must be 2-%d lowercase letters, digits, hyphens and underscores starting with a letter", ErrInvalidDatabaseName, id, maxDatabaseIDLength)
+	}
+	return nil
+}
+
+// nameTemplate makes database names from a template such as "{prefix}-{checksum8}-{rand}".
+//
+// The placeholders are:
+//
+//   - {prefix}: the prefix passed to Create and GetOrCreate
+//   - {checksum8}: the first 8 characters of the checksum of the pool
+//   - {timestamp}: the creation time in Unix seconds
+//   - {rand}: 8 random lowercase letters and digits
+//   - {env:NAME}: the value of the environment variable NAME
+//
+// Values of environment variables are lowercased, characters which cannot appear in database IDs are replaced
+// with hyphens, and they are truncated if the name is too long. Other parts are never changed.
+type nameTemplate struct {
+	text     string
+	segments []nameSegment
+}
+
+type nameSegment struct {
+	// literal is the text of the segment if placeholder is empty.
+	literal     string
+	placeholder string
+	// env is the name of the environment variable of {env:NAME}.
+	env string
+}
+
+// parseNameTemplate parses text as a name template. The template must contain {rand} so that names do not collide.
+func parseNameTemplate(text string) (*nameTemplate, error) {
+	t := &nameTemplate{text: text}
+	hasRand := false
+	last := 0
+	for _, m := range nameTemplatePlaceholderRegexp.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > last {
+			t.segments = append(t.segments, nameSegment{literal: text[last:m[0]]})
+		}
+		last = m[1]
+
+		placeholder := text[m[2]:m[3]]
+		switch {
+		case placeholder == "prefix", placeholder == "checksum8", placeholder == "timestamp":
+			t.segments = append(t.segments, nameSegment{placeholder: placeholder})
+		case placeholder == "rand":
+			hasRand = true
+			t.segments = append(t.segments, nameSegment{placeholder: placeholder})
+		case strings.HasPrefix(placeholder, "env:") && len(placeholder) > len("env:"):
+			t.segments = append(t.segments, nameSegment{placeholder: "env", env: strings.TrimPrefix(placeholder, "env:")})
+		default:
+			return nil, fmt.Errorf("%w: unknown placeholder {%s} in name template %q", ErrInvalidDatabaseName, placeholder, text)
+		}
+	}
+	if last < len(text) {
+		t.segments = append(t.segments, nameSegment{literal: text[last:]})
+	}
+	for _, s := range t.segments {
+		if s.placeholder == "" && invalidDatabaseIDCharsRegexp.MatchString(s.literal) {
+			return nil, fmt.Errorf("%w: name template %q must contain only lowercase letters, digits, hyphens, underscores and placeholders", ErrInvalidDatabaseName, text)
+		}
+	}
+	if !hasRand {
+		return nil, fmt.Errorf("%w: name template %q must contain {rand}", ErrInvalidDatabaseName, text)
+	}
+	return t, nil
+}
+
+// execute makes a new database name.
+func (t *nameTemplate) execute(prefix, checksum string, now time.Time) (string, error) {
+	if strings.Contains(t.text, "{prefix}") {
+		if err := validatePrefixChars(prefix); err != nil {
+			return "", err
+		}
+	}
+
+	values := make([]string, len(t.segments))
+	length := 0
+	for i, s := range t.segments {
+		switch s.placeholder {
+		case "":
+			values[i] = s.literal
+		case "prefix":
+			values[i] = prefix
+		case "checksum8":
+			values[i] = checksum[:min(shortChecksumLength, len(checksum))]
+		case "timestamp":
+			values[i] = strconv.FormatInt(now.Unix(), 10)
+		case "rand":
+			suffix, err := randomSuffix()
+			if err != nil {
+				return "", err
+			}
+			values[i] = suffix
+		case "env":
+			values[i] = sanitizeDatabaseID(os.Getenv(s.env))
+		}
+		length += len(values[i])
+	}
+
+	// Environment variables such as branch names are shortened from the longest until the name fits.
+	for length > maxDatabaseIDLength {
+		longest := -1
+		for i, s := range t.segments {
+			if s.placeholder == "env" && len(values[i]) > 0 && (longest < 0 || len(values[i]) > len(values[longest])) {
+				longest = i
+			}
+		}
+		if longest < 0 {
+			return "", fmt.Errorf("%w: name template %q with prefix %q makes names longer than %d characters", ErrInvalidDatabaseName, t.text, prefix, maxDatabaseIDLength)
+		}
+		values[longest] = values[longest][:len(values[longest])-1]
+		length--
+	}
+
+	name := strings.Join(values, "")
+	if err := validateDatabaseID(name); err != nil {
+		return "", fmt.Errorf("name template %q: %w", t.text, err)
+	}
+	return name, nil
+}
+
+// sanitizeDatabaseID lowercases s and replaces characters which cannot appear in database IDs with hyphens.
+func sanitizeDatabaseID(s string) string {
+	return invalidDatabaseIDCharsRegexp.ReplaceAllString(strings.ToLower(s), "-")
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, databaseNameSuffixLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = databaseNameSuffixChars[int(b[i])%len(databaseNameSuffixChars)]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,132 @@
+package spool
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateDatabaseNamePrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		prefix  string
+		wantErr bool
+	}{
+		"valid":                  {prefix: "spool-test"},
+		"single letter":          {prefix: "s"},
+		"underscore":             {prefix: "spool_test"},
+		"trailing hyphen":        {prefix: "spool-"},
+		"max length":             {prefix: strings.Repeat("s", MaxDatabaseNamePrefixLength)},
+		"empty":                  {prefix: "", wantErr: true},
+		"uppercase":              {prefix: "Spool", wantErr: true},
+		"starting with digit":    {prefix: "1spool", wantErr: true},
+		"starting with hyphen":   {prefix: "-spool", wantErr: true},
+		"invalid character":      {prefix: "spool.test", wantErr: true},
+		"longer than max length": {prefix: strings.Repeat("s", MaxDatabaseNamePrefixLength+1), wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateDatabaseNamePrefix(tt.prefix)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDatabaseName) {
+					t.Errorf("expected ErrInvalidDatabaseName but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	t.Setenv("SPOOL_TEST_BRANCH", "Feature/Add-Very-Long-Branch-Name")
+	t.Setenv("SPOOL_TEST_EMPTY", "")
+
+	const checksum = "0123456789abcdef"
+	now := time.Unix(1700000000, 0)
+	tests := map[string]struct {
+		template string
+		prefix   string
+		want     *regexp.Regexp
+		wantErr  bool
+	}{
+		"default": {
+			template: DefaultNameTemplate,
+			prefix:   "spool",
+			want:     regexp.MustCompile(`^spool-[a-z0-9]{8}$`),
+		},
+		"checksum and timestamp": {
+			template: "{prefix}-{checksum8}-{timestamp}{rand}",
+			prefix:   "s",
+			want:     regexp.MustCompile(`^s-01234567-1700000000[a-z0-9]{8}$`),
+		},
+		"sanitized and truncated environment variable": {
+			template: "{prefix}-{env:SPOOL_TEST_BRANCH}-{rand}",
+			prefix:   "spool",
+			want:     regexp.MustCompile(`^spool-feature-add-ver-[a-z0-9]{8}$`),
+		},
+		"empty environment variable": {
+			template: "{prefix}{env:SPOOL_TEST_EMPTY}-{rand}",
+			prefix:   "spool",
+			want:     regexp.MustCompile(`^spool-[a-z0-9]{8}$`),
+		},
+		"invalid prefix": {
+			template: DefaultNameTemplate,
+			prefix:   "Spool",
+			wantErr:  true,
+		},
+		"too long prefix": {
+			template: DefaultNameTemplate,
+			prefix:   strings.Repeat("s", MaxDatabaseNamePrefixLength+1),
+			wantErr:  true,
+		},
+		"starting with a digit": {
+			template: "{checksum8}-{rand}",
+			wantErr:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := parseNameTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 10 {
+				got, err := tmpl.execute(tt.prefix, checksum, now)
+				if tt.wantErr {
+					if !errors.Is(err, ErrInvalidDatabaseName) {
+						t.Fatalf("expected ErrInvalidDatabaseName but got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.want.MatchString(got) {
+					t.Errorf("expected %s but got %s", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseNameTemplate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, template := range []string{
+		"{prefix}",
+		"{prefix}-{unknown}-{rand}",
+		"{prefix}-{env:}-{rand}",
+		"{prefix}.{rand}",
+		"Spool-{rand}",
+	} {
+		if _, err := parseNameTemplate(template); !errors.Is(err, ErrInvalidDatabaseName) {
+			t.Errorf("%s: expected ErrInvalidDatabaseName but got %v", template, err)
+		}
+	}
+}
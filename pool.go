@@ -1,13 +1,15 @@
 package spool
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"strings"
+	"sync"
 	"time"
 
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"cloud.google.com/go/spanner"
 	admin "cloud.google.com/go/spanner/admin/database/apiv1"
 	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
@@ -16,34 +18,123 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-// State represents a state of the database.
-type State int64
+// PutOption represents an option for Put.
+type PutOption func(*putOptions)
 
-const (
-	// StateIdle represents a idle state.
-	StateIdle State = iota
-	// StateBusy represents a busy state.
-	StateBusy
-	// StateNotFound represents a database does not exist state.
-	StateNotFound
-)
+type putOptions struct {
+	force bool
+	reset bool
+}
+
+// WithForce returns the database even if the caller does not hold its checkout token.
+func WithForce() PutOption {
+	return func(o *putOptions) {
+		o.force = true
+	}
+}
+
+// WithReset deletes all rows in the database before returning it to the pool.
+func WithReset() PutOption {
+	return func(o *putOptions) {
+		o.reset = true
+	}
+}
+
+func newPutOptions(opts []PutOption) *putOptions {
+	o := &putOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// GetOption represents an option for Get and GetOrCreate.
+type GetOption func(*getOptions)
+
+type getOptions struct {
+	lease       time.Duration
+	jobID       string
+	waitTimeout time.Duration
+}
+
+// WithLease sets the lease duration of the checkout.
+// A busy database whose lease has expired is treated as idle by later Get calls.
+// If d is zero, the checkout never expires.
+func WithLease(d time.Duration) GetOption {
+	return func(o *getOptions) {
+		o.lease = d
+	}
+}
+
+// WithJobID sets the job ID recorded as a part of the holder of the checkout.
+// If it is not set, the job ID is detected from well-known CI environment variables.
+func WithJobID(jobID string) GetOption {
+	return func(o *getOptions) {
+		o.jobID = jobID
+	}
+}
 
-// Int64 returns s as int64.
-func (s State) Int64() int64 {
-	return int64(s)
+// WithWaitTimeout makes Get wait up to d for an idle database, and GetOrCreate wait up to d
+// for a database to be returned when the pool is full.
+// Waiters are served in rough FIFO order.
+// If d is zero, they return the error immediately.
+func WithWaitTimeout(d time.Duration) GetOption {
+	return func(o *getOptions) {
+		o.waitTimeout = d
+	}
+}
+
+func newGetOptions(opts []GetOption) *getOptions {
+	o := &getOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Option represents an option for NewPool.
+type Option func(*Pool)
+
+// WithSeed sets the data loaded into each database after it is created or reset.
+// Databases with different seeds are never mixed because the seed is a part of the checksum.
+func WithSeed(seed *Seed) Option {
+	return func(p *Pool) {
+		p.seed = seed
+	}
+}
+
+// WithMinIdle sets the number of idle databases the pool keeps.
+// Maintain and Get create databases named with dbNamePrefix until there are at least n idle databases.
+func WithMinIdle(n int, dbNamePrefix string) Option {
+	return func(p *Pool) {
+		p.minIdle = n
+		p.minIdlePrefix = dbNamePrefix
+	}
+}
+
+// WithMaxSize limits the number of databases with the checksum of the pool.
+// Databases which are not found are not counted.
+func WithMaxSize(n int) Option {
+	return func(p *Pool) {
+		p.maxSize = n
+	}
+}
+
+// WithMaxInstanceSize limits the number of all databases managed by the metadata database.
+// Databases which are not found are not counted.
+func WithMaxInstanceSize(n int) Option {
+	return func(p *Pool) {
+		p.maxInstanceSize = n
+	}
 }
 
-// String returns a string representing the state.
-func (s State) String() string {
-	switch s {
-	case StateIdle:
-		return "idle"
-	case StateBusy:
-		return "busy"
-	case StateNotFound:
-		return "notfound"
+// WithNameTemplate sets the template of new database names. See DefaultNameTemplate for the default.
+// The template can contain {prefix}, {checksum8}, {timestamp}, {rand} and {env:NAME}, and must contain {rand}.
+// For example, "{prefix}-{env:BRANCH}-{rand}" names databases after the branch of the CI job.
+func WithNameTemplate(template string) Option {
+	return func(p *Pool) {
+		p.nameTemplateText = template
 	}
-	return "unknown"
 }
 
 // Pool represents a Spanner database pool.
@@ -52,11 +143,43 @@ type Pool struct {
 	adminClient   *admin.DatabaseAdminClient
 	conf          *Config
 	ddlStatements []string
-	checksum      string
+	// normalized is the normalized DDL statements of the schema.
+	normalized []string
+	checksum   string
+	seed       *Seed
+	// migrations is set if the pool is made from migrations.
+	migrations []*Migration
+	// previousChecksums maps the checksums of earlier versions of the migrations to the versions.
+	previousChecksums map[string]int64
+	// legacyChecksum is the checksum of the raw DDL used by older versions of spool,
+	// set if it differs from checksum and the pool is made from plain DDL without a seed.
+	legacyChecksum   string
+	minIdle          int
+	minIdlePrefix    string
+	maxSize          int
+	maxInstanceSize  int
+	nameTemplateText string
+	nameTemplate     *nameTemplate
+
+	// maintenance is the state of the background maintenance started by Get.
+	maintenance struct {
+		sync.Mutex
+		running bool
+		wg      sync.WaitGroup
+		err     error
+	}
 }
 
 // NewPool creates a new Pool.
-func NewPool(ctx context.Context, conf *Config, ddl []byte) (*Pool, error) {
+func NewPool(ctx context.Context, conf *Config, ddl []byte, opts ...Option) (*Pool, error) {
+	ddlStatements, err := ddlToStatements(ddl)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := NormalizeDDL(ddl)
+	if err != nil {
+		return nil, err
+	}
 	client, err := spanner.NewClient(ctx, conf.Database(), conf.ClientOptions()...)
 	if err != nil {
 		return nil, err
@@ -66,134 +189,597 @@ func NewPool(ctx context.Context, conf *Config, ddl []byte) (*Pool, error) {
 		return nil, err
 	}
 	pool := &Pool{
-		client:        client,
-		adminClient:   adminClient,
-		conf:          conf,
-		ddlStatements: ddlToStatements(ddl),
-		checksum:      checksum(ddl),
+		client:           client,
+		adminClient:      adminClient,
+		conf:             conf,
+		ddlStatements:    ddlStatements,
+		normalized:       normalized,
+		nameTemplateText: DefaultNameTemplate,
+	}
+	for _, opt := range opts {
+		opt(pool)
+	}
+	pool.nameTemplate, err = parseNameTemplate(pool.nameTemplateText)
+	if err != nil {
+		return nil, err
+	}
+	pool.checksum = Checksum(normalized, pool.seed)
+	// Older versions of spool had neither migrations nor seeds, so only such pools can have their databases.
+	if len(pool.migrations) == 0 && pool.seed == nil {
+		if legacy := legacyChecksum(ddl); legacy != pool.checksum {
+			pool.legacyChecksum = legacy
+		}
+	}
+	if len(pool.migrations) > 0 {
+		pool.previousChecksums, err = previousChecksums(pool.migrations, pool.seed)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return pool, nil
 }
 
-func ddlToStatements(ddl []byte) []string {
-	ddls := bytes.Split(ddl, []byte(";"))
-	ddlStatements := make([]string, 0, len(ddls))
-	for _, s := range ddls {
-		if stmt := strings.TrimSpace(string(s)); stmt != "" {
-			ddlStatements = append(ddlStatements, stmt)
-		}
+// migrationVersion returns the latest version of the migrations, or zero if the pool is not made from migrations.
+func (p *Pool) migrationVersion() int64 {
+	if len(p.migrations) == 0 {
+		return 0
+	}
+	return p.migrations[len(p.migrations)-1].Version
+}
+
+// checksums returns the checksum of the pool and the legacy checksum if any.
+// Databases with the legacy checksum are handed out as databases of the pool.
+func (p *Pool) checksums() []string {
+	if p.legacyChecksum == "" {
+		return []string{p.checksum}
+	}
+	return []string{p.checksum, p.legacyChecksum}
+}
+
+// availableChecksums returns the checksums of all databases which Get hands out,
+// including those upgraded from earlier versions of the migrations.
+func (p *Pool) availableChecksums() []string {
+	checksums := p.checksums()
+	for checksum := range p.previousChecksums {
+		checksums = append(checksums, checksum)
+	}
+	return checksums
+}
+
+func newCheckoutToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return ddlStatements
+	return hex.EncodeToString(b), nil
 }
 
-func checksum(ddl []byte) string {
-	return fmt.Sprintf("%x", sha256.Sum256(ddl))
+// maxNameAttempts is the number of names Create tries when a name is already taken.
+const maxNameAttempts = 5
+
+// newDatabaseName makes a new database name from the name template of the pool.
+func (p *Pool) newDatabaseName(dbNamePrefix string) (string, error) {
+	return p.nameTemplate.execute(dbNamePrefix, p.checksum, time.Now())
 }
 
+// creationLease is the lease of the row reserved for a database being created.
+// If the creator dies, the row is regarded as stuck after the lease expires and resolved by Recover.
+const creationLease = time.Hour
+
 // Create creates a new database and adds to the pool.
+// The database is named by the template set by WithNameTemplate, dbNamePrefix followed by a hyphen
+// and a random suffix by default. If the name is already taken, another name is tried.
+// It returns ErrPoolFull if the pool has reached the size set by WithMaxSize or WithMaxInstanceSize.
 func (p *Pool) Create(ctx context.Context, dbNamePrefix string) (*model.SpoolDatabase, error) {
-	dbName := fmt.Sprintf("%s-%d", dbNamePrefix, time.Now().Unix())
-	sdb := &model.SpoolDatabase{
-		DatabaseName: dbName,
-		Checksum:     p.checksum,
-		State:        StateIdle.Int64(),
-		CreatedAt:    spanner.CommitTimestamp,
-		UpdatedAt:    spanner.CommitTimestamp,
-	}
-	return p.create(ctx, sdb)
-}
-
-func (p *Pool) create(ctx context.Context, sdb *model.SpoolDatabase) (*model.SpoolDatabase, error) {
-	op, err := p.adminClient.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
-		Parent:          p.conf.Instance(),
-		CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", sdb.DatabaseName),
-		ExtraStatements: p.ddlStatements,
-	})
+	return p.create(ctx, dbNamePrefix, StateIdle, currentHolder(""), 0, 0)
+}
+
+// create reserves a row for a new database, creates the database and then changes the row to the state to.
+// The row is creating with the name of the CreateDatabase operation while the database is being created,
+// so that Get never hands it out and Recover can resume the creation if the creator dies.
+// If minIdle is positive, it returns errIdleEnough without creating anything when the pool has minIdle databases
+// which are idle or being created.
+func (p *Pool) create(ctx context.Context, dbNamePrefix string, to State, holder *Holder, lease time.Duration, minIdle int) (*model.SpoolDatabase, error) {
+	// The name is made before any request so that an invalid prefix or template fails early.
+	name, err := p.newDatabaseName(dbNamePrefix)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := op.Wait(ctx); err != nil {
+	token, err := newCheckoutToken()
+	if err != nil {
+		return nil, err
+	}
+	var sdb *model.SpoolDatabase
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if name, err = p.newDatabaseName(dbNamePrefix); err != nil {
+				return nil, err
+			}
+		}
+		sdb = &model.SpoolDatabase{
+			DatabaseName: name,
+			State:        StateCreating.Int64(),
+			CreatedAt:    spanner.CommitTimestamp,
+			UpdatedAt:    spanner.CommitTimestamp,
+		}
+		sdb.ChangeSchema(p.checksum, p.migrationVersion())
+		sdb.ChangeCheckoutToken(token)
+		setHolder(sdb, holder)
+		if err := p.reserve(ctx, sdb, minIdle); err != nil {
+			if spanner.ErrCode(err) == codes.AlreadyExists && attempt < maxNameAttempts {
+				continue
+			}
+			return nil, err
+		}
+		err = p.createDatabase(ctx, sdb)
+		if err == nil {
+			break
+		}
+		if spanner.ErrCode(err) == codes.AlreadyExists {
+			// The database is not ours, so only the reservation is removed.
+			p.unreserve(ctx, sdb)
+			if attempt < maxNameAttempts {
+				continue
+			}
+		} else {
+			p.discard(ctx, sdb)
+		}
+		return nil, err
+	}
+
+	created, err := p.finalize(ctx, sdb.DatabaseName, token, to, lease)
+	if err != nil {
+		// Someone else owns the row if the reservation was lost.
+		if !errors.Is(err, ErrLeaseLost) {
+			p.discard(ctx, sdb)
+		}
 		return nil, err
 	}
-	ts, err := p.client.Apply(ctx, []*spanner.Mutation{sdb.Insert(ctx)})
+	return created, nil
+}
+
+// finalize changes the row of the database created with token from creating to the state to.
+func (p *Pool) finalize(ctx context.Context, dbName, token string, to State, lease time.Duration) (*model.SpoolDatabase, error) {
+	var sdb *model.SpoolDatabase
+	ts, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		var err error
+		sdb, err = model.FindSpoolDatabase(ctx, txn, dbName)
+		if err != nil {
+			return err
+		}
+		if sdb.State != StateCreating.Int64() || !sdb.HeldBy(token) {
+			return fmt.Errorf("%w: %s", ErrLeaseLost, dbName)
+		}
+		if err := changeState(sdb, to); err != nil {
+			return err
+		}
+		now, err := model.CurrentTimestamp(ctx, txn)
+		if err != nil {
+			return err
+		}
+		// The lease starts after the database is ready, not when the creation was requested.
+		sdb.ChangeLease(now, lease)
+		sdb.ChangeOperationName("")
+		if to == StateIdle {
+			sdb.ChangeCheckoutToken("")
+			setHolder(sdb, nil)
+		}
+		if err := txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)}); err != nil {
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		_ = dropDatabase(ctx, p.conf.WithDatabaseID(sdb.DatabaseName))
 		return nil, err
 	}
-	sdb.CreatedAt = ts
 	sdb.UpdatedAt = ts
 	return sdb, nil
 }
 
-// Get gets a idle database from the pool.
-func (p *Pool) Get(ctx context.Context) (*model.SpoolDatabase, error) {
-	for {
-		var sdb *model.SpoolDatabase
-		if _, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
-			var err error
-			sdb, err = model.FindSpoolDatabaseByChecksumState(ctx, txn, p.checksum, StateIdle.Int64())
+// reserve inserts sdb with creationLease unless the pool has reached its maximum size,
+// or has minIdle databases which are idle or being created if minIdle is positive.
+// Counting and inserting in one transaction prevents concurrent callers from exceeding the sizes.
+func (p *Pool) reserve(ctx context.Context, sdb *model.SpoolDatabase, minIdle int) error {
+	ts, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		if minIdle > 0 {
+			n, err := model.CountIdleOrCreatingSpoolDatabases(ctx, txn, p.checksum, StateIdle.Int64(), StateCreating.Int64())
 			if err != nil {
 				return err
 			}
-
-			exist, err := p.existDatabase(ctx, sdb.DatabaseName)
+			if n >= int64(minIdle) {
+				return errIdleEnough
+			}
+		}
+		if p.maxSize > 0 {
+			n, err := model.CountSpoolDatabases(ctx, txn, p.checksum, StateNotFound.Int64())
 			if err != nil {
 				return err
 			}
-			if exist {
-				sdb.ChangeState(StateBusy.Int64())
-			} else {
-				sdb.ChangeState(StateNotFound.Int64())
+			if n >= int64(p.maxSize) {
+				return fmt.Errorf("%w: %d databases with checksum %s", ErrPoolFull, n, p.checksum)
 			}
+		}
+		if p.maxInstanceSize > 0 {
+			n, err := model.CountSpoolDatabases(ctx, txn, "", StateNotFound.Int64())
+			if err != nil {
+				return err
+			}
+			if n >= int64(p.maxInstanceSize) {
+				return fmt.Errorf("%w: %d databases in total", ErrPoolFull, n)
+			}
+		}
+		now, err := model.CurrentTimestamp(ctx, txn)
+		if err != nil {
+			return err
+		}
+		sdb.ChangeLease(now, creationLease)
+		return txn.BufferWrite([]*spanner.Mutation{sdb.Insert(ctx)})
+	})
+	if err != nil {
+		return err
+	}
+	sdb.CreatedAt = ts
+	sdb.UpdatedAt = ts
+	return nil
+}
+
+// createDatabase creates the database with the schema and loads the seed.
+func (p *Pool) createDatabase(ctx context.Context, sdb *model.SpoolDatabase) error {
+	dbName := sdb.DatabaseName
+	if err := retryResourceExhausted(ctx, func() error {
+		op, err := p.adminClient.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+			Parent:          p.conf.Instance(),
+			CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", dbName),
+			ExtraStatements: p.ddlStatements,
+		})
+		if err != nil {
+			return err
+		}
+		// The operation is recorded before waiting so that Recover can resume it if the process dies.
+		sdb.ChangeOperationName(op.Name())
+		m, err := sdb.UpdateColumns(ctx, "OperationName")
+		if err != nil {
+			return err
+		}
+		if _, err := p.client.Apply(ctx, []*spanner.Mutation{m}); err != nil {
+			return err
+		}
+		_, err = op.Wait(ctx)
+		return err
+	}); err != nil {
+		return err
+	}
+	return p.prepareDatabase(ctx, dbName)
+}
 
-			if err := txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)}); err != nil {
+// prepareDatabase stamps the migration version and loads the seed into a newly created database.
+func (p *Pool) prepareDatabase(ctx context.Context, dbName string) error {
+	if p.seed == nil && len(p.migrations) == 0 {
+		return nil
+	}
+	return p.withDatabaseClient(ctx, dbName, func(client *spanner.Client) error {
+		if len(p.migrations) > 0 {
+			if err := stampMigrationVersion(ctx, client, p.migrationVersion()); err != nil {
 				return err
 			}
-			return nil
-		}); err != nil {
+		}
+		if p.seed != nil {
+			return applySeed(ctx, client, p.seed)
+		}
+		return nil
+	})
+}
+
+// cleanupTimeout bounds the cleanup of a database whose creation has failed or has been canceled.
+const cleanupTimeout = time.Minute
+
+// discard cleans up the database which failed to be created, even if ctx has been canceled.
+// The CreateDatabase operation is canceled if it is in progress, and then the database and its reservation are removed.
+// If the database cannot be dropped within cleanupTimeout, the reservation is left for Recover.
+func (p *Pool) discard(ctx context.Context, sdb *model.SpoolDatabase) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+	if sdb.OperationName.Valid {
+		_ = p.adminClient.CancelOperation(ctx, &longrunningpb.CancelOperationRequest{Name: sdb.OperationName.StringVal})
+		// The database cannot be dropped until the operation stops.
+		_, _ = p.adminClient.CreateDatabaseOperation(sdb.OperationName.StringVal).Wait(ctx)
+	}
+	_ = p.drop(ctx, sdb)
+}
+
+// unreserve deletes the row reserved for sdb.
+func (p *Pool) unreserve(ctx context.Context, sdb *model.SpoolDatabase) {
+	ctx = context.WithoutCancel(ctx)
+	_, _ = p.client.Apply(ctx, []*spanner.Mutation{sdb.Delete(ctx)})
+}
+
+// Get gets a idle database from the pool.
+// A busy database whose lease has expired is also regarded as idle.
+// The returned database has a new checkout token which identifies the caller as the holder.
+// If the pool is made from migrations and there is no idle database of the latest version,
+// an idle database of an earlier version is upgraded by applying the pending migrations.
+// If WithWaitTimeout is set, it waits up to the duration for a database to become idle.
+func (p *Pool) Get(ctx context.Context, opts ...GetOption) (*model.SpoolDatabase, error) {
+	o := newGetOptions(opts)
+	holder := currentHolder(o.jobID)
+	get := func(ctx context.Context) (*model.SpoolDatabase, error) {
+		return p.get(ctx, holder, o.lease)
+	}
+	if o.waitTimeout <= 0 {
+		return get(ctx)
+	}
+	return p.wait(ctx, o.waitTimeout, get, isErrNotFound)
+}
+
+func (p *Pool) get(ctx context.Context, holder *Holder, lease time.Duration) (*model.SpoolDatabase, error) {
+	token, err := newCheckoutToken()
+	if err != nil {
+		return nil, err
+	}
+	sdb, err := p.checkout(ctx, token, holder, lease, p.checksums())
+	if err != nil && isErrNotFound(err) && len(p.previousChecksums) > 0 {
+		sdb, err = p.upgrade(ctx, token, holder, lease)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.maintainInBackground(ctx)
+	return sdb, nil
+}
+
+// checkoutCandidates is the number of available databases fetched at once by checkout.
+const checkoutCandidates = 10
+
+// checkout marks an available database with one of checksums as busy with token.
+//
+// Candidates are found outside of a read-write transaction in an order shuffled per call,
+// so that concurrent callers try different databases instead of locking the same row.
+// The existence of each candidate is checked before its row is locked,
+// and the row is claimed in a transaction which reads only that row.
+// Databases which no longer exist are marked as not found and skipped.
+func (p *Pool) checkout(ctx context.Context, token string, holder *Holder, lease time.Duration, checksums []string) (*model.SpoolDatabase, error) {
+	for {
+		candidates, err := model.FindAvailableSpoolDatabasesByChecksums(ctx, p.client.Single(), checksums, StateIdle.Int64(), StateBusy.Int64(), token, checkoutCandidates)
+		if err != nil {
 			return nil, err
 		}
-		if sdb.State == StateNotFound.Int64() {
-			continue
+		for _, candidate := range candidates {
+			exist, err := p.existDatabase(ctx, candidate.DatabaseName)
+			if err != nil {
+				return nil, err
+			}
+			sdb, err := p.claim(ctx, candidate, exist, token, holder, lease)
+			if err != nil {
+				return nil, err
+			}
+			if sdb != nil && exist {
+				return sdb, nil
+			}
+		}
+	}
+}
+
+// claim marks the candidate as busy with token if exist, or as not found otherwise.
+// It returns nil if the candidate has been changed by another caller since it was found.
+func (p *Pool) claim(ctx context.Context, candidate *model.SpoolDatabase, exist bool, token string, holder *Holder, lease time.Duration) (*model.SpoolDatabase, error) {
+	var sdb *model.SpoolDatabase
+	if _, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		var err error
+		sdb, err = model.FindSpoolDatabase(ctx, txn, candidate.DatabaseName)
+		if err != nil {
+			return err
+		}
+		if !unchanged(sdb, candidate) {
+			sdb = nil
+			return nil
+		}
+
+		if exist {
+			if err := changeState(sdb, StateBusy); err != nil {
+				return err
+			}
+			now, err := model.CurrentTimestamp(ctx, txn)
+			if err != nil {
+				return err
+			}
+			sdb.ChangeLease(now, lease)
+			sdb.ChangeCheckoutToken(token)
+			setHolder(sdb, holder)
+			if p.legacyChecksum != "" && sdb.Checksum == p.legacyChecksum {
+				// The database is relabeled so that it is counted and cleaned with the others from now on.
+				sdb.ChangeSchema(p.checksum, 0)
+			}
+		} else {
+			if err := changeState(sdb, StateNotFound); err != nil {
+				return err
+			}
+			sdb.ClearLease()
+			sdb.ChangeCheckoutToken("")
+			setHolder(sdb, nil)
+		}
+
+		if err := txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)}); err != nil {
+			return err
 		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return sdb, nil
+}
+
+// unchanged reports whether sdb is in the same checkout as when it was read as found.
+// Every checkout changes the token and every state change updates UpdatedAt,
+// so the availability of found still holds for sdb without comparing the clock.
+func unchanged(sdb, found *model.SpoolDatabase) bool {
+	return sdb.State == found.State &&
+		sdb.CheckoutToken == found.CheckoutToken &&
+		sdb.UpdatedAt.Equal(found.UpdatedAt)
+}
 
-		return sdb, nil
+// upgrade checks out an available database made from an earlier version of the migrations
+// and applies the pending migrations to it.
+func (p *Pool) upgrade(ctx context.Context, token string, holder *Holder, lease time.Duration) (*model.SpoolDatabase, error) {
+	checksums := make([]string, 0, len(p.previousChecksums))
+	for checksum := range p.previousChecksums {
+		checksums = append(checksums, checksum)
+	}
+	sdb, err := p.checkout(ctx, token, holder, lease, checksums)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.migrate(ctx, sdb.DatabaseName, p.previousChecksums[sdb.Checksum]); err != nil {
+		// The database may be partially migrated, so it must not be reused.
+		_ = p.release(ctx, sdb.DatabaseName, token, StateQuarantined, false)
+		return nil, err
+	}
+
+	ts, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		var err error
+		sdb, err = model.FindSpoolDatabase(ctx, txn, sdb.DatabaseName)
+		if err != nil {
+			return err
+		}
+		if sdb.State != StateBusy.Int64() || !sdb.HeldBy(token) {
+			return fmt.Errorf("%w: %s", ErrLeaseLost, sdb.DatabaseName)
+		}
+		sdb.ChangeSchema(p.checksum, p.migrationVersion())
+		now, err := model.CurrentTimestamp(ctx, txn)
+		if err != nil {
+			return err
+		}
+		// The lease starts after the database is ready, as for a new database.
+		sdb.ChangeLease(now, lease)
+		if err := txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)}); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	sdb.UpdatedAt = ts
+	return sdb, nil
 }
 
-// GetOrCreate gets a idle database or creates a new database.
-func (p *Pool) GetOrCreate(ctx context.Context, dbNamePrefix string) (*model.SpoolDatabase, error) {
-	sdb, err := p.Get(ctx)
-	if err == nil {
-		return sdb, nil
+// migrate applies the migrations newer than version to the database and stamps the latest version.
+func (p *Pool) migrate(ctx context.Context, dbName string, version int64) error {
+	stmts, err := pendingStatements(p.migrations, version)
+	if err != nil {
+		return err
+	}
+	if len(stmts) > 0 {
+		op, err := p.adminClient.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+			Database:   p.conf.WithDatabaseID(dbName).Database(),
+			Statements: stmts,
+		})
+		if err != nil {
+			return err
+		}
+		if err := op.Wait(ctx); err != nil {
+			return err
+		}
 	}
-	if !isErrNotFound(err) {
+	return p.withDatabaseClient(ctx, dbName, func(client *spanner.Client) error {
+		return stampMigrationVersion(ctx, client, p.migrationVersion())
+	})
+}
+
+// GetOrCreate gets a idle database or creates a new database.
+// If the pool has reached its maximum size, it waits for a database to be returned
+// up to the duration set by WithWaitTimeout.
+func (p *Pool) GetOrCreate(ctx context.Context, dbNamePrefix string, opts ...GetOption) (*model.SpoolDatabase, error) {
+	if _, err := p.newDatabaseName(dbNamePrefix); err != nil {
 		return nil, err
 	}
-	dbName := fmt.Sprintf("%s-%d", dbNamePrefix, time.Now().Unix())
-	sdb = &model.SpoolDatabase{
-		DatabaseName: dbName,
-		Checksum:     p.checksum,
-		State:        StateBusy.Int64(),
-		CreatedAt:    spanner.CommitTimestamp,
-		UpdatedAt:    spanner.CommitTimestamp,
+	o := newGetOptions(opts)
+	holder := currentHolder(o.jobID)
+	getOrCreate := func(ctx context.Context) (*model.SpoolDatabase, error) {
+		sdb, err := p.get(ctx, holder, o.lease)
+		if err == nil || !isErrNotFound(err) {
+			return sdb, err
+		}
+		return p.create(ctx, dbNamePrefix, StateBusy, holder, o.lease, 0)
+	}
+	if o.waitTimeout <= 0 {
+		return getOrCreate(ctx)
+	}
+	return p.wait(ctx, o.waitTimeout, getOrCreate, func(err error) bool {
+		return errors.Is(err, ErrPoolFull)
+	})
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
-	return p.create(ctx, sdb)
 }
 
 // List gets all databases from the pool.
 func (p *Pool) List(ctx context.Context) ([]*model.SpoolDatabase, error) {
-	return model.FindSpoolDatabasesByChecksum(ctx, p.client.ReadOnlyTransaction(), p.checksum)
+	txn := p.client.ReadOnlyTransaction()
+	defer txn.Close()
+	sdbs := []*model.SpoolDatabase{}
+	for _, checksum := range p.checksums() {
+		found, err := model.FindSpoolDatabasesByChecksum(ctx, txn, checksum)
+		if err != nil {
+			return nil, err
+		}
+		sdbs = append(sdbs, found...)
+	}
+	return sdbs, nil
+}
+
+// Put returns a database checked out with token to the pool.
+// It returns ErrLeaseLost if the database is held by someone else.
+func (p *Pool) Put(ctx context.Context, dbName, token string, opts ...PutOption) error {
+	o := newPutOptions(opts)
+	if o.reset {
+		// Make sure that the caller holds the database before deleting its rows.
+		sdb, err := model.FindSpoolDatabase(ctx, p.client.Single(), dbName)
+		if err != nil {
+			return err
+		}
+		if err := checkRelease(sdb, token, StateIdle, o.force); err != nil {
+			return err
+		}
+		if err := p.reset(ctx, dbName); err != nil {
+			return err
+		}
+	}
+	return p.release(ctx, dbName, token, StateIdle, o.force)
 }
 
-// Put adds a database to the pool.
-func (p *Pool) Put(ctx context.Context, dbName string) error {
+// Quarantine marks a database checked out with token as quarantined so that it is never reused.
+// It returns ErrLeaseLost if the database is held by someone else.
+func (p *Pool) Quarantine(ctx context.Context, dbName, token string) error {
+	return p.release(ctx, dbName, token, StateQuarantined, false)
+}
+
+func (p *Pool) release(ctx context.Context, dbName, token string, to State, force bool) error {
 	if _, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
 		sdb, err := model.FindSpoolDatabase(ctx, txn, dbName)
 		if err != nil {
 			return err
 		}
-		sdb.ChangeState(StateIdle.Int64())
+		if err := checkRelease(sdb, token, to, force); err != nil {
+			return err
+		}
+		if err := changeState(sdb, to); err != nil {
+			return err
+		}
+		sdb.ClearLease()
+		sdb.ChangeCheckoutToken("")
+		if to == StateIdle {
+			// Keep the holder of a quarantined database to find out who quarantined it.
+			setHolder(sdb, nil)
+		}
 		if err := txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)}); err != nil {
 			return err
 		}
@@ -204,15 +790,97 @@ func (p *Pool) Put(ctx context.Context, dbName string) error {
 	return nil
 }
 
-// Clean removes all idle databases.
-func (p *Pool) Clean(ctx context.Context, filters ...func(sdb *model.SpoolDatabase) bool) error {
-	return clean(ctx, p.client, p.conf, func(ctx context.Context, txn *spanner.ReadWriteTransaction) ([]*model.SpoolDatabase, error) {
-		sdbs, err := model.FindSpoolDatabasesByChecksumState(ctx, txn, p.checksum, StateIdle.Int64())
+func checkRelease(sdb *model.SpoolDatabase, token string, to State, force bool) error {
+	// A stale holder must learn that it lost the database rather than getting a state error.
+	if !force && !sdb.HeldBy(token) && State(sdb.State) == StateBusy {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, sdb.DatabaseName)
+	}
+	if from := State(sdb.State); !from.canTransitionTo(to) {
+		return fmt.Errorf("%w: %s cannot change from %s to %s", ErrInvalidTransition, sdb.DatabaseName, from, to)
+	}
+	return nil
+}
+
+// reset deletes all rows in the database and loads the seed again.
+func (p *Pool) reset(ctx context.Context, dbName string) error {
+	return p.withDatabaseClient(ctx, dbName, func(client *spanner.Client) error {
+		if err := resetDatabase(ctx, client, len(p.migrations) > 0); err != nil {
+			return err
+		}
+		if p.seed != nil {
+			return applySeed(ctx, client, p.seed)
+		}
+		return nil
+	})
+}
+
+// withDatabaseClient calls f with a client for the pooled database.
+func (p *Pool) withDatabaseClient(ctx context.Context, dbName string, f func(client *spanner.Client) error) error {
+	client, err := spanner.NewClient(ctx, p.conf.WithDatabaseID(dbName).Database(), p.conf.ClientOptions()...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return f(client)
+}
+
+// Renew extends the lease of the database checked out with token to expire after d from now.
+// It returns ErrLeaseLost if the database has been returned or taken by someone else.
+func (p *Pool) Renew(ctx context.Context, dbName, token string, d time.Duration) (*model.SpoolDatabase, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("invalid lease duration: %s", d)
+	}
+	var sdb *model.SpoolDatabase
+	ts, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		var err error
+		sdb, err = model.FindSpoolDatabase(ctx, txn, dbName)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if sdb.State != StateBusy.Int64() || !sdb.HeldBy(token) {
+			return fmt.Errorf("%w: %s", ErrLeaseLost, dbName)
+		}
+		now, err := model.CurrentTimestamp(ctx, txn)
+		if err != nil {
+			return err
+		}
+		sdb.ChangeLease(now, d)
+		sdb.UpdatedAt = spanner.CommitTimestamp
+		if err := txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)}); err != nil {
+			return err
 		}
-		return filter(sdbs, filters...), nil
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	sdb.UpdatedAt = ts
+	return sdb, nil
+}
+
+// Clean removes the idle databases of the schema of the pool which pass filters, and resumes dropping
+// the databases left deleting by an interrupted clean regardless of filters.
+func (p *Pool) Clean(ctx context.Context, filters ...func(sdb *model.SpoolDatabase) bool) error {
+	plan, err := p.PlanClean(ctx, filters...)
+	if err != nil {
+		return err
+	}
+	return executeClean(ctx, plan)
+}
+
+// PlanClean returns the plan of Clean without dropping any database.
+func (p *Pool) PlanClean(ctx context.Context, filters ...func(sdb *model.SpoolDatabase) bool) (*CleanPlan, error) {
+	sdbs := []*model.SpoolDatabase{}
+	for _, checksum := range p.checksums() {
+		for _, state := range []State{StateIdle, StateDeleting} {
+			found, err := model.FindSpoolDatabasesByChecksumState(ctx, p.client.Single(), checksum, state.Int64())
+			if err != nil {
+				return nil, err
+			}
+			sdbs = append(sdbs, found...)
+		}
+	}
+	return newCleanPlan(p.client, p.adminClient, p.conf, sdbs, filters...), nil
 }
 
 func (p *Pool) existDatabase(ctx context.Context, dbName string) (bool, error) {
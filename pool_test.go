@@ -2,9 +2,12 @@ package spool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/spanner"
 	"github.com/cloudspannerecosystem/spool/model"
@@ -39,7 +42,7 @@ func TestPool_Create(t *testing.T) {
 }
 
 func TestPool_Get(t *testing.T) {
-	// t.Parallel() // this test can't be parallel because it uses time.Now().Unix()
+	t.Parallel()
 
 	cfg := SetupTestDatabase(t)
 
@@ -50,7 +53,7 @@ func TestPool_Get(t *testing.T) {
 	pool := newPool(ctx, t, cfg, ddl1)
 	sdb := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test",
-		Checksum:     checksum(ddl1),
+		Checksum:     ddlChecksum(t, ddl1),
 		State:        StateIdle.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
@@ -74,9 +77,13 @@ func TestPool_Get(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if _, err := pool.Get(ctx); err != nil {
+		got, err := pool.Get(ctx, WithJobID("job"))
+		if err != nil {
 			t.Fatal(err)
 		}
+		if h := HolderOf(got); h == nil || h.JobID != "job" {
+			t.Errorf("expected holder with job ID but got %v", h)
+		}
 	})
 	t.Run("not found (already used)", func(t *testing.T) {
 		if _, err := pool.Get(ctx); err != nil {
@@ -87,10 +94,73 @@ func TestPool_Get(t *testing.T) {
 			t.Fatal("should not get busy database")
 		}
 	})
+	t.Run("found (lease expired)", func(t *testing.T) {
+		sdb, err := pool.Create(ctx, fmt.Sprintf("%s-lease", spoolSpannerDatabaseNamePrefix()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The database is checked out with a lease which expired an hour ago.
+		sdb.State = StateBusy.Int64()
+		sdb.ChangeCheckoutToken("expired")
+		sdb.ChangeLease(time.Now().Add(-2*time.Hour), time.Hour)
+		m, err := sdb.UpdateColumns(ctx, "State", "CheckoutToken", "LeaseExpiresAt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Apply(ctx, []*spanner.Mutation{m}); err != nil {
+			t.Fatalf("failed to update fixture: %s", err)
+		}
+		got, err := pool.Get(ctx, WithLease(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DatabaseName != sdb.DatabaseName {
+			t.Errorf("expected %s but got %s", sdb.DatabaseName, got.DatabaseName)
+		}
+		if got.LeaseExpired(time.Now()) {
+			t.Error("lease should be extended")
+		}
+	})
+}
+
+func TestPool_GetLegacyChecksum(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	sdb, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The database was created by an older version of spool, which used the checksum of the raw DDL.
+	sdb.ChangeSchema(legacyChecksum(ddl1), 0)
+	m, err := sdb.UpdateColumns(ctx, "Checksum", "UpdatedAt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Apply(ctx, []*spanner.Mutation{m}); err != nil {
+		t.Fatalf("failed to update fixture: %s", err)
+	}
+
+	got, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DatabaseName != sdb.DatabaseName {
+		t.Errorf("expected %s but got %s", sdb.DatabaseName, got.DatabaseName)
+	}
+	if got.Checksum != pool.checksum {
+		t.Errorf("expected the database to be relabeled with %s but got %s", pool.checksum, got.Checksum)
+	}
 }
 
 func TestPool_GetOrCreate(t *testing.T) {
-	// t.Parallel() // this test can't be parallel because it uses time.Now().Unix()
+	t.Parallel()
 
 	cfg := SetupTestDatabase(t)
 
@@ -101,7 +171,7 @@ func TestPool_GetOrCreate(t *testing.T) {
 	pool := newPool(ctx, t, cfg, ddl1)
 	sdb := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test",
-		Checksum:     checksum(ddl1),
+		Checksum:     ddlChecksum(t, ddl1),
 		State:        StateIdle.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
@@ -147,14 +217,14 @@ func TestPool_List(t *testing.T) {
 	pool := newPool(ctx, t, cfg, ddl1)
 	sdb1 := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test-1",
-		Checksum:     checksum(ddl1),
+		Checksum:     ddlChecksum(t, ddl1),
 		State:        StateIdle.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
 	}
 	sdb2 := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test-2",
-		Checksum:     checksum(ddl2),
+		Checksum:     ddlChecksum(t, ddl2),
 		State:        StateIdle.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
@@ -187,25 +257,124 @@ func TestPool_Put(t *testing.T) {
 	pool := newPool(ctx, t, cfg, ddl1)
 	sdb := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test",
-		Checksum:     checksum(ddl1),
+		Checksum:     ddlChecksum(t, ddl1),
+		State:        StateBusy.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	sdb.ChangeCheckoutToken("token")
+	if _, err := client.Apply(ctx, []*spanner.Mutation{sdb.Insert(ctx)}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	t.Run("token mismatch", func(t *testing.T) {
+		if err := pool.Put(ctx, sdb.DatabaseName, "another-token"); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("expected ErrLeaseLost but got %v", err)
+		}
+	})
+	t.Run("put", func(t *testing.T) {
+		if err := pool.Put(ctx, sdb.DatabaseName, "token"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := model.FindSpoolDatabase(ctx, client.Single(), sdb.DatabaseName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := State(got.State); state != StateIdle {
+			t.Errorf("expected %s but got %s", StateIdle, state)
+		}
+		if got.CheckoutToken.Valid {
+			t.Errorf("expected checkout token to be cleared but got %s", got.CheckoutToken.StringVal)
+		}
+	})
+	t.Run("already idle", func(t *testing.T) {
+		if err := pool.Put(ctx, sdb.DatabaseName, "token", WithForce()); !errors.Is(err, ErrInvalidTransition) {
+			t.Fatalf("expected ErrInvalidTransition but got %v", err)
+		}
+	})
+}
+
+func TestPool_Quarantine(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	sdb := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test",
+		Checksum:     ddlChecksum(t, ddl1),
 		State:        StateBusy.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
 	}
+	sdb.ChangeCheckoutToken("token")
 	if _, err := client.Apply(ctx, []*spanner.Mutation{sdb.Insert(ctx)}); err != nil {
 		t.Fatalf("failed to setup fixture: %s", err)
 	}
 
-	if err := pool.Put(ctx, sdb.DatabaseName); err != nil {
+	if err := pool.Quarantine(ctx, sdb.DatabaseName, "token"); err != nil {
 		t.Fatal(err)
 	}
 	got, err := model.FindSpoolDatabase(ctx, client.Single(), sdb.DatabaseName)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if state := State(got.State); state != StateQuarantined {
+		t.Errorf("expected %s but got %s", StateQuarantined, state)
+	}
+	if err := pool.Put(ctx, sdb.DatabaseName, "token", WithForce()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected ErrInvalidTransition but got %v", err)
+	}
+}
+
+func TestPool_Renew(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	sdb := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test",
+		Checksum:     ddlChecksum(t, ddl1),
+		State:        StateBusy.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
 	}
-	if state := State(got.State); state != StateIdle {
-		t.Errorf("expected %s but got %s", StateIdle, state)
+	sdb.ChangeLease(time.Now(), time.Minute)
+	sdb.ChangeCheckoutToken("token")
+	if _, err := client.Apply(ctx, []*spanner.Mutation{sdb.Insert(ctx)}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
 	}
+
+	t.Run("renewed", func(t *testing.T) {
+		if _, err := pool.Renew(ctx, sdb.DatabaseName, "token", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		got, err := model.FindSpoolDatabase(ctx, client.Single(), sdb.DatabaseName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.LeaseExpiresAt.Time.After(sdb.LeaseExpiresAt.Time) {
+			t.Errorf("expected lease to be extended beyond %s but got %s", sdb.LeaseExpiresAt.Time, got.LeaseExpiresAt.Time)
+		}
+		// The lease is based on the time of Cloud Spanner, which also sets UpdatedAt.
+		if d := got.LeaseExpiresAt.Time.Sub(got.UpdatedAt); d < time.Hour-10*time.Second || d > time.Hour {
+			t.Errorf("expected lease to expire an hour after the update but got %s", d)
+		}
+	})
+	t.Run("lease lost", func(t *testing.T) {
+		if _, err := pool.Renew(ctx, sdb.DatabaseName, "another-token", time.Hour); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("expected ErrLeaseLost but got %v", err)
+		}
+	})
 }
 
 func TestPool_Clean(t *testing.T) {
@@ -220,14 +389,14 @@ func TestPool_Clean(t *testing.T) {
 	pool := newPool(ctx, t, cfg, ddl1)
 	sdb1 := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test-1",
-		Checksum:     checksum(ddl1),
+		Checksum:     ddlChecksum(t, ddl1),
 		State:        StateIdle.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
 	}
 	sdb2 := &model.SpoolDatabase{
 		DatabaseName: "zoncoen-spool-test-2",
-		Checksum:     checksum(ddl2),
+		Checksum:     ddlChecksum(t, ddl2),
 		State:        StateIdle.Int64(),
 		CreatedAt:    spanner.CommitTimestamp,
 		UpdatedAt:    spanner.CommitTimestamp,
@@ -254,3 +423,306 @@ func TestPool_Clean(t *testing.T) {
 		}
 	})
 }
+
+func TestPool_PlanClean(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	sdb1 := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test-1",
+		Checksum:     ddlChecksum(t, ddl1),
+		State:        StateIdle.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	sdb2 := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test-2",
+		Checksum:     ddlChecksum(t, ddl1),
+		State:        StateIdle.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	if _, err := client.Apply(ctx, []*spanner.Mutation{sdb1.Insert(ctx), sdb2.Insert(ctx)}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	plan, err := pool.PlanClean(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(plan.Databases); got != 2 {
+		t.Fatalf("expected 2 databases in the plan but got %d", got)
+	}
+	t.Run("planning should not delete", func(t *testing.T) {
+		if _, err := model.FindSpoolDatabase(ctx, client.Single(), sdb1.DatabaseName); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// sdb2 is checked out after the plan was made.
+	busy := &model.SpoolDatabase{DatabaseName: sdb2.DatabaseName, State: StateBusy.Int64(), UpdatedAt: spanner.CommitTimestamp}
+	m, err := busy.UpdateColumns(ctx, "State", "UpdatedAt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Apply(ctx, []*spanner.Mutation{m}); err != nil {
+		t.Fatalf("failed to update fixture: %s", err)
+	}
+
+	progress := 0
+	results, err := plan.Execute(ctx, WithCleanParallelism(2), WithCleanProgress(func(*CleanResult) { progress++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(results); got != 2 {
+		t.Fatalf("expected 2 results but got %d", got)
+	}
+	if progress != 2 {
+		t.Errorf("expected progress for 2 databases but got %d", progress)
+	}
+	for _, r := range results {
+		if expected, got := r.Database.DatabaseName == sdb2.DatabaseName, r.Skipped; expected != got {
+			t.Errorf("%s: expected skipped %t but got %t", r.Database.DatabaseName, expected, got)
+		}
+		if r.Err != nil {
+			t.Errorf("%s: unexpected error: %s", r.Database.DatabaseName, r.Err)
+		}
+	}
+	t.Run("should be deleted", func(t *testing.T) {
+		if _, err := model.FindSpoolDatabase(ctx, client.Single(), sdb1.DatabaseName); err != nil {
+			if !isErrNotFound(err) {
+				t.Fatal(err)
+			}
+		} else {
+			t.Fatal("should be deleted")
+		}
+	})
+	t.Run("database changed after planning should not be deleted", func(t *testing.T) {
+		if _, err := model.FindSpoolDatabase(ctx, client.Single(), sdb2.DatabaseName); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPool_PlanCleanCanceled(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	ms := []*spanner.Mutation{}
+	for i := range 3 {
+		sdb := &model.SpoolDatabase{
+			DatabaseName: fmt.Sprintf("zoncoen-spool-test-%d", i),
+			Checksum:     ddlChecksum(t, ddl1),
+			State:        StateIdle.Int64(),
+			CreatedAt:    spanner.CommitTimestamp,
+			UpdatedAt:    spanner.CommitTimestamp,
+		}
+		ms = append(ms, sdb.Insert(ctx))
+	}
+	if _, err := client.Apply(ctx, ms); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	plan, err := pool.PlanClean(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Execute is canceled as soon as the first database is done, while the others wait for it.
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results, err := plan.Execute(cctx, WithCleanParallelism(1), WithCleanProgress(func(*CleanResult) { cancel() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled := 0
+	for _, r := range results {
+		if r.Database.UpdatedAt == spanner.CommitTimestamp {
+			t.Errorf("%s: expected the commit timestamp of marking but got the placeholder", r.Database.DatabaseName)
+		}
+		if r.Err == nil {
+			continue
+		}
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("%s: unexpected error: %s", r.Database.DatabaseName, r.Err)
+			continue
+		}
+		canceled++
+		sdb, err := model.FindSpoolDatabase(ctx, client.Single(), r.Database.DatabaseName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := State(sdb.State); state != StateDeleting {
+			t.Errorf("%s: expected deleting but got %s", sdb.DatabaseName, state)
+		}
+	}
+	if canceled != 2 {
+		t.Errorf("expected 2 databases not to be dropped but got %d", canceled)
+	}
+}
+
+func TestPool_CleanResume(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	// A database left deleting by an interrupted clean.
+	sdb := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test-1",
+		Checksum:     ddlChecksum(t, ddl1),
+		State:        StateDeleting.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	if _, err := client.Apply(ctx, []*spanner.Mutation{sdb.Insert(ctx)}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	// The filter would exclude the database if it were idle.
+	if err := pool.Clean(ctx, FilterNotUsedWithin(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := model.FindSpoolDatabase(ctx, client.Single(), sdb.DatabaseName); err != nil {
+		if !isErrNotFound(err) {
+			t.Fatal(err)
+		}
+	} else {
+		t.Fatal("should be deleted")
+	}
+}
+
+func TestPool_CreateMaxSize(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	busy := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test-busy",
+		Checksum:     ddlChecksum(t, ddl1),
+		State:        StateBusy.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	other := &model.SpoolDatabase{
+		DatabaseName: "zoncoen-spool-test-other",
+		Checksum:     ddlChecksum(t, ddl2),
+		State:        StateIdle.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	if _, err := client.Apply(ctx, []*spanner.Mutation{busy.Insert(ctx), other.Insert(ctx)}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	tests := map[string]Option{
+		"max size":          WithMaxSize(1),
+		"max instance size": WithMaxInstanceSize(2),
+	}
+	for name, opt := range tests {
+		t.Run(name, func(t *testing.T) {
+			pool, err := NewPool(ctx, cfg, ddl1, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix()); !errors.Is(err, ErrPoolFull) {
+				t.Errorf("expected ErrPoolFull but got %v", err)
+			}
+			if _, err := pool.GetOrCreate(ctx, spoolSpannerDatabaseNamePrefix(), WithWaitTimeout(0)); !errors.Is(err, ErrPoolFull) {
+				t.Errorf("expected ErrPoolFull but got %v", err)
+			}
+		})
+	}
+}
+
+// BenchmarkPool_Get measures the throughput of Get and Put with 50 concurrent getters sharing 10 databases.
+func BenchmarkPool_Get(b *testing.B) {
+	const (
+		getters   = 50
+		databases = 10
+	)
+
+	cfg := SetupTestDatabase(b)
+
+	ctx := context.Background()
+	pool, err := NewPool(ctx, cfg, ddl1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		if err := pool.Clean(ctx); err != nil {
+			b.Error(err)
+		}
+	})
+	for i := range databases {
+		if _, err := pool.Create(ctx, fmt.Sprintf("%s-bench%d", spoolSpannerDatabaseNamePrefix(), i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		n       = b.N
+		retries int
+	)
+	b.ResetTimer()
+	for range getters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if n == 0 {
+					mu.Unlock()
+					return
+				}
+				n--
+				mu.Unlock()
+
+				for {
+					sdb, err := pool.Get(ctx)
+					if isErrNotFound(err) {
+						mu.Lock()
+						retries++
+						mu.Unlock()
+						continue
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					if err := pool.Put(ctx, sdb.DatabaseName, sdb.CheckoutToken.StringVal); err != nil {
+						b.Error(err)
+						return
+					}
+					break
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "gets/s")
+	b.ReportMetric(float64(retries)/float64(b.N), "retries/op")
+}
@@ -0,0 +1,253 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/cloudspannerecosystem/spool/model"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+)
+
+// DriftKind represents a kind of difference between the metadata and the databases on the instance.
+type DriftKind string
+
+const (
+	// DriftNotFound is a row marked as not found. Fixing it deletes the row.
+	DriftNotFound DriftKind = "notfound"
+	// DriftMissing is an idle or quarantined row whose database no longer exists. Fixing it deletes the row.
+	DriftMissing DriftKind = "missing"
+	// DriftBusyMissing is a busy row whose database no longer exists.
+	// It is only reported because its holder may still refer to it.
+	DriftBusyMissing DriftKind = "busy-missing"
+	// DriftOrphan is a database with one of the prefixes which has no row. Fixing it adopts or drops the database.
+	DriftOrphan DriftKind = "orphan"
+)
+
+// Drift represents a difference between the metadata and the databases on the instance.
+type Drift struct {
+	Kind         DriftKind
+	DatabaseName string
+	// Database is the row of the database, nil for DriftOrphan.
+	Database *model.SpoolDatabase
+}
+
+// OrphanAction represents how FixDrift resolves an orphan database.
+type OrphanAction string
+
+const (
+	// OrphanKeep leaves orphan databases as they are.
+	OrphanKeep OrphanAction = "keep"
+	// OrphanAdopt adds orphan databases with the schema of the pool as idle databases.
+	OrphanAdopt OrphanAction = "adopt"
+	// OrphanDrop drops orphan databases.
+	OrphanDrop OrphanAction = "drop"
+)
+
+// Reconcile compares all rows in the metadata database with the databases on the instance and returns the drifts.
+// Databases without a row are reported as orphans only if their names start with one of dbNamePrefixes,
+// because the instance may hold databases which are not managed by spool.
+// Rows in the creating and deleting states are left to Recover and Clean.
+func (p *Pool) Reconcile(ctx context.Context, dbNamePrefixes []string) ([]*Drift, error) {
+	// The rows are read before the databases are listed. A database whose creation finishes in between
+	// is listed while its row was read as creating, so it is not reported as missing and purged.
+	// A database created after the rows were read may be reported as an orphan, but its row makes FixDrift skip it.
+	sdbs, err := model.FindAllSpoolDatabases(ctx, p.client.Single())
+	if err != nil {
+		return nil, err
+	}
+	existing, err := p.listInstanceDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := []*Drift{}
+	known := map[string]bool{}
+	for _, sdb := range sdbs {
+		known[sdb.DatabaseName] = true
+		var kind DriftKind
+		switch State(sdb.State) {
+		case StateNotFound:
+			kind = DriftNotFound
+		case StateIdle, StateQuarantined:
+			if !existing[sdb.DatabaseName] {
+				kind = DriftMissing
+			}
+		case StateBusy:
+			if !existing[sdb.DatabaseName] {
+				kind = DriftBusyMissing
+			}
+		}
+		if kind != "" {
+			drifts = append(drifts, &Drift{Kind: kind, DatabaseName: sdb.DatabaseName, Database: sdb})
+		}
+	}
+
+	orphans := []string{}
+	for name := range existing {
+		if known[name] || name == p.conf.DatabaseID() {
+			continue
+		}
+		if slices.ContainsFunc(dbNamePrefixes, func(prefix string) bool { return strings.HasPrefix(name, prefix) }) {
+			orphans = append(orphans, name)
+		}
+	}
+	slices.Sort(orphans)
+	for _, name := range orphans {
+		drifts = append(drifts, &Drift{Kind: DriftOrphan, DatabaseName: name})
+	}
+	return drifts, nil
+}
+
+// FixDrift repairs the drift found by Reconcile. Orphan databases are resolved by orphan.
+// It reports whether anything has been changed. Drifts which have been resolved by others since Reconcile,
+// such as rows which have changed or appeared, are skipped.
+func (p *Pool) FixDrift(ctx context.Context, d *Drift, orphan OrphanAction) (bool, error) {
+	switch d.Kind {
+	case DriftNotFound, DriftMissing:
+		return p.purge(ctx, d.Database)
+	case DriftOrphan:
+		switch orphan {
+		case OrphanAdopt:
+			return p.adopt(ctx, d.DatabaseName)
+		case OrphanDrop:
+			return p.dropOrphan(ctx, d.DatabaseName)
+		}
+	}
+	return false, nil
+}
+
+// purge deletes the row of sdb unless it has changed since it was found.
+func (p *Pool) purge(ctx context.Context, sdb *model.SpoolDatabase) (bool, error) {
+	purged := false
+	if _, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		purged = false
+		current, err := model.FindSpoolDatabase(ctx, txn, sdb.DatabaseName)
+		if err != nil {
+			if isErrNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if !unchanged(current, sdb) {
+			return nil
+		}
+		purged = true
+		return txn.BufferWrite([]*spanner.Mutation{current.Delete(ctx)})
+	}); err != nil {
+		return false, err
+	}
+	return purged, nil
+}
+
+// claimOrphan inserts sdb as the row of the orphan database with creationLease, so that the database is not touched
+// if a row has appeared since Reconcile listed the databases. It reports false if the row already exists.
+func (p *Pool) claimOrphan(ctx context.Context, sdb *model.SpoolDatabase) (bool, error) {
+	setHolder(sdb, currentHolder(""))
+	if _, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		now, err := model.CurrentTimestamp(ctx, txn)
+		if err != nil {
+			return err
+		}
+		sdb.ChangeLease(now, creationLease)
+		return txn.BufferWrite([]*spanner.Mutation{sdb.Insert(ctx)})
+	}); err != nil {
+		if spanner.ErrCode(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// dropOrphan drops the orphan database unless a row has appeared for it.
+// The row is marked deleting while the database is dropped, so a failed drop is resumed by Clean.
+func (p *Pool) dropOrphan(ctx context.Context, dbName string) (bool, error) {
+	sdb := &model.SpoolDatabase{
+		DatabaseName: dbName,
+		State:        StateDeleting.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	if claimed, err := p.claimOrphan(ctx, sdb); err != nil || !claimed {
+		return false, err
+	}
+	return true, p.drop(ctx, sdb)
+}
+
+// adopt adds the orphan database as an idle database of the pool if its schema is the same as the pool.
+// The rows are deleted and the seed is loaded again, since the database may have been used.
+// The database is claimed as creating first, and left untouched if a row has appeared for it.
+func (p *Pool) adopt(ctx context.Context, dbName string) (bool, error) {
+	token, err := newCheckoutToken()
+	if err != nil {
+		return false, err
+	}
+	sdb := &model.SpoolDatabase{
+		DatabaseName: dbName,
+		State:        StateCreating.Int64(),
+		CreatedAt:    spanner.CommitTimestamp,
+		UpdatedAt:    spanner.CommitTimestamp,
+	}
+	sdb.ChangeSchema(p.checksum, p.migrationVersion())
+	sdb.ChangeCheckoutToken(token)
+	if claimed, err := p.claimOrphan(ctx, sdb); err != nil || !claimed {
+		return false, err
+	}
+	if err := p.prepareOrphan(ctx, dbName); err != nil {
+		// The database is left as it is, since it may not belong to the pool.
+		p.unreserve(ctx, sdb)
+		return false, err
+	}
+	if _, err := p.finalize(ctx, dbName, token, StateIdle, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// prepareOrphan checks that the schema of the orphan database is the same as the pool, then deletes its rows and loads the seed.
+func (p *Pool) prepareOrphan(ctx context.Context, dbName string) error {
+	resp, err := p.adminClient.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{
+		Database: p.conf.WithDatabaseID(dbName).Database(),
+	})
+	if err != nil {
+		return err
+	}
+	normalized, err := NormalizeDDL([]byte(strings.Join(resp.GetStatements(), ";\n")))
+	if err != nil {
+		return fmt.Errorf("%s: %w", dbName, err)
+	}
+	// The instance may return the statements in another order than the schema file.
+	if !slices.Equal(slices.Sorted(slices.Values(normalized)), slices.Sorted(slices.Values(p.normalized))) {
+		return fmt.Errorf("%s: the schema of the database is different from the pool", dbName)
+	}
+
+	if err := p.withDatabaseClient(ctx, dbName, func(client *spanner.Client) error {
+		return resetDatabase(ctx, client, len(p.migrations) > 0)
+	}); err != nil {
+		return err
+	}
+	return p.prepareDatabase(ctx, dbName)
+}
+
+// listInstanceDatabases returns the IDs of all databases on the instance.
+func (p *Pool) listInstanceDatabases(ctx context.Context) (map[string]bool, error) {
+	names := map[string]bool{}
+	iter := p.adminClient.ListDatabases(ctx, &databasepb.ListDatabasesRequest{Parent: p.conf.Instance()})
+	for {
+		db, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names[path.Base(db.GetName())] = true
+	}
+	return names, nil
+}
@@ -0,0 +1,126 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestPool_Reconcile(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	if _, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := map[State]*model.SpoolDatabase{}
+	for _, state := range []State{StateNotFound, StateIdle, StateBusy} {
+		sdb := &model.SpoolDatabase{
+			DatabaseName: fmt.Sprintf("zoncoen-spool-test-%s", state),
+			Checksum:     ddlChecksum(t, ddl1),
+			State:        state.Int64(),
+			CreatedAt:    spanner.CommitTimestamp,
+			UpdatedAt:    spanner.CommitTimestamp,
+		}
+		if _, err := client.Apply(ctx, []*spanner.Mutation{sdb.Insert(ctx)}); err != nil {
+			t.Fatalf("failed to setup fixture: %s", err)
+		}
+		rows[state] = sdb
+	}
+
+	// Other tests create databases on the same instance, so the orphan has a unique prefix.
+	suffix, err := randomSuffix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphanPrefix := "orphan" + suffix
+	orphan := orphanPrefix + "-db"
+	op, err := pool.adminClient.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          cfg.Instance(),
+		CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", orphan),
+		ExtraStatements: pool.ddlStatements,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := op.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	drifts, err := pool.Reconcile(ctx, []string{orphanPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]DriftKind{}
+	for _, d := range drifts {
+		got[d.DatabaseName] = d.Kind
+	}
+	want := map[string]DriftKind{
+		rows[StateNotFound].DatabaseName: DriftNotFound,
+		rows[StateIdle].DatabaseName:     DriftMissing,
+		rows[StateBusy].DatabaseName:     DriftBusyMissing,
+		orphan:                           DriftOrphan,
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+	for name, kind := range want {
+		if got[name] != kind {
+			t.Errorf("expected %s to be %s but got %q", name, kind, got[name])
+		}
+	}
+
+	for _, d := range drifts {
+		fixed, err := pool.FixDrift(ctx, d, OrphanAdopt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixed != (d.Kind != DriftBusyMissing) {
+			t.Errorf("unexpected fixed %t for %s %s", fixed, d.Kind, d.DatabaseName)
+		}
+	}
+	for _, state := range []State{StateNotFound, StateIdle} {
+		if _, err := model.FindSpoolDatabase(ctx, client.Single(), rows[state].DatabaseName); !isErrNotFound(err) {
+			t.Errorf("expected the %s row to be purged but got %v", state, err)
+		}
+	}
+	if _, err := model.FindSpoolDatabase(ctx, client.Single(), rows[StateBusy].DatabaseName); err != nil {
+		t.Errorf("expected the busy row to be kept but got %v", err)
+	}
+	adopted, err := model.FindSpoolDatabase(ctx, client.Single(), orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := State(adopted.State); state != StateIdle || adopted.Checksum != pool.checksum {
+		t.Errorf("expected an idle database with the checksum of the pool but got %s %s", state, adopted.Checksum)
+	}
+
+	// The orphan drift is stale now that the database has a row, so it must not be dropped or adopted again.
+	for _, action := range []OrphanAction{OrphanDrop, OrphanAdopt} {
+		fixed, err := pool.FixDrift(ctx, &Drift{Kind: DriftOrphan, DatabaseName: orphan}, action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixed {
+			t.Errorf("expected the stale orphan to be skipped by %s", action)
+		}
+	}
+	kept, err := model.FindSpoolDatabase(ctx, client.Single(), orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if State(kept.State) != StateIdle {
+		t.Errorf("expected the adopted database to be kept idle but got %s", State(kept.State))
+	}
+}
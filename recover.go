@@ -0,0 +1,132 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/cloudspannerecosystem/spool/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryResult represents how Recover resolved a database stuck in the creating state.
+type RecoveryResult string
+
+const (
+	// RecoveryIdle means the creation has completed and the database has become idle.
+	RecoveryIdle RecoveryResult = "idle"
+	// RecoveryDropped means the creation has failed or cannot be resumed, and the database and its row have been removed.
+	RecoveryDropped RecoveryResult = "dropped"
+)
+
+// ListStuck returns the databases of the pool which are creating and whose creation lease has expired,
+// which means the process creating them has died.
+func (p *Pool) ListStuck(ctx context.Context) ([]*model.SpoolDatabase, error) {
+	txn := p.client.ReadOnlyTransaction()
+	defer txn.Close()
+	sdbs, err := model.FindSpoolDatabasesByChecksumState(ctx, txn, p.checksum, StateCreating.Int64())
+	if err != nil {
+		return nil, err
+	}
+	// Leases are compared with the time of Cloud Spanner, since the clock of this host may be skewed.
+	now, err := model.CurrentTimestamp(ctx, txn)
+	if err != nil {
+		return nil, err
+	}
+	stuck := []*model.SpoolDatabase{}
+	for _, sdb := range sdbs {
+		if sdb.LeaseExpired(now) {
+			stuck = append(stuck, sdb)
+		}
+	}
+	return stuck, nil
+}
+
+// Recover resolves a database stuck in the creating state.
+// If the CreateDatabase operation was recorded, it waits for the operation and makes the database idle
+// after loading the seed again. Otherwise, or if the operation has failed, the database and its row are removed.
+// It returns ErrNotStuck if the database is not creating or its creation lease has not expired.
+func (p *Pool) Recover(ctx context.Context, dbName string) (RecoveryResult, error) {
+	token, err := newCheckoutToken()
+	if err != nil {
+		return "", err
+	}
+	sdb, err := p.claimStuck(ctx, dbName, token)
+	if err != nil {
+		return "", err
+	}
+
+	if !sdb.OperationName.Valid {
+		// The process died before the operation was started or recorded.
+		return RecoveryDropped, p.drop(ctx, sdb)
+	}
+	op := p.adminClient.CreateDatabaseOperation(sdb.OperationName.StringVal)
+	if _, err := op.Wait(ctx); err != nil {
+		switch {
+		case op.Done():
+			return RecoveryDropped, p.drop(ctx, sdb)
+		case status.Code(err) == codes.NotFound:
+			// Old operations are deleted, so whether the database exists tells whether the creation has completed.
+			exist, err := p.existDatabase(ctx, dbName)
+			if err != nil {
+				return "", err
+			}
+			if !exist {
+				return RecoveryDropped, p.drop(ctx, sdb)
+			}
+		default:
+			return "", err
+		}
+	}
+
+	// The process may have died while loading the seed, so it is loaded from scratch.
+	if err := p.withDatabaseClient(ctx, dbName, func(client *spanner.Client) error {
+		return resetDatabase(ctx, client, len(p.migrations) > 0)
+	}); err != nil {
+		return "", err
+	}
+	if err := p.prepareDatabase(ctx, dbName); err != nil {
+		return "", err
+	}
+	if _, err := p.finalize(ctx, dbName, token, StateIdle, 0); err != nil {
+		return "", err
+	}
+	return RecoveryIdle, nil
+}
+
+// claimStuck takes over the creation of a stuck database with token.
+func (p *Pool) claimStuck(ctx context.Context, dbName, token string) (*model.SpoolDatabase, error) {
+	var sdb *model.SpoolDatabase
+	if _, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		var err error
+		sdb, err = model.FindSpoolDatabase(ctx, txn, dbName)
+		if err != nil {
+			return err
+		}
+		now, err := model.CurrentTimestamp(ctx, txn)
+		if err != nil {
+			return err
+		}
+		if sdb.State != StateCreating.Int64() || !sdb.LeaseExpired(now) {
+			return fmt.Errorf("%w: %s is %s", ErrNotStuck, dbName, State(sdb.State))
+		}
+		sdb.ChangeLease(now, creationLease)
+		sdb.ChangeCheckoutToken(token)
+		setHolder(sdb, currentHolder(""))
+		sdb.UpdatedAt = spanner.CommitTimestamp
+		return txn.BufferWrite([]*spanner.Mutation{sdb.Update(ctx)})
+	}); err != nil {
+		return nil, err
+	}
+	return sdb, nil
+}
+
+// drop drops the database if it exists and deletes its row.
+func (p *Pool) drop(ctx context.Context, sdb *model.SpoolDatabase) error {
+	if err := dropDatabase(ctx, p.adminClient, p.conf.WithDatabaseID(sdb.DatabaseName)); err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	_, err := p.client.Apply(ctx, []*spanner.Mutation{sdb.Delete(ctx)})
+	return err
+}
@@ -0,0 +1,107 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestPool_Recover(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+
+	dbName, err := pool.newDatabaseName(spoolSpannerDatabaseNamePrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, err := pool.adminClient.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          cfg.Instance(),
+		CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", dbName),
+		ExtraStatements: pool.ddlStatements,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := &model.SpoolDatabase{
+		DatabaseName:   dbName,
+		Checksum:       ddlChecksum(t, ddl1),
+		State:          StateCreating.Int64(),
+		CreatedAt:      spanner.CommitTimestamp,
+		UpdatedAt:      spanner.CommitTimestamp,
+		LeaseExpiresAt: spanner.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}
+	resumed.ChangeOperationName(op.Name())
+	unstarted := &model.SpoolDatabase{
+		DatabaseName:   "zoncoen-spool-test-unstarted",
+		Checksum:       ddlChecksum(t, ddl1),
+		State:          StateCreating.Int64(),
+		CreatedAt:      spanner.CommitTimestamp,
+		UpdatedAt:      spanner.CommitTimestamp,
+		LeaseExpiresAt: spanner.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}
+	inProgress := &model.SpoolDatabase{
+		DatabaseName:   "zoncoen-spool-test-in-progress",
+		Checksum:       ddlChecksum(t, ddl1),
+		State:          StateCreating.Int64(),
+		CreatedAt:      spanner.CommitTimestamp,
+		UpdatedAt:      spanner.CommitTimestamp,
+		LeaseExpiresAt: spanner.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	}
+	if _, err := client.Apply(ctx, []*spanner.Mutation{resumed.Insert(ctx), unstarted.Insert(ctx), inProgress.Insert(ctx)}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	stuck, err := pool.ListStuck(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stuck) != 2 {
+		t.Fatalf("expected 2 stuck databases but got %d", len(stuck))
+	}
+
+	if _, err := pool.Recover(ctx, inProgress.DatabaseName); !errors.Is(err, ErrNotStuck) {
+		t.Errorf("expected ErrNotStuck but got %v", err)
+	}
+
+	result, err := pool.Recover(ctx, unstarted.DatabaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != RecoveryDropped {
+		t.Errorf("expected %s but got %s", RecoveryDropped, result)
+	}
+	if _, err := model.FindSpoolDatabase(ctx, client.Single(), unstarted.DatabaseName); !isErrNotFound(err) {
+		t.Errorf("expected the row to be deleted but got %v", err)
+	}
+
+	result, err = pool.Recover(ctx, resumed.DatabaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != RecoveryIdle {
+		t.Errorf("expected %s but got %s", RecoveryIdle, result)
+	}
+	got, err := model.FindSpoolDatabase(ctx, client.Single(), resumed.DatabaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := State(got.State); state != StateIdle {
+		t.Errorf("expected %s but got %s", StateIdle, state)
+	}
+	if got.OperationName.Valid || got.CheckoutToken.Valid {
+		t.Errorf("expected the operation and the token to be cleared but got %v and %v", got.OperationName, got.CheckoutToken)
+	}
+}
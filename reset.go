@@ -0,0 +1,261 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+)
+
+// partitionedDeleteThreshold is the number of rows above which a table is deleted with partitioned DML
+// instead of in a single transaction.
+const partitionedDeleteThreshold = 10000
+
+// deleteMutationsPerCommit is the number of mutations, estimated as the deleted rows and their index entries,
+// which a commit deleting tables may contain. It is well below the limit of Cloud Spanner.
+const deleteMutationsPerCommit = 20000
+
+// table represents a user table and the tables which must be deleted after it.
+type table struct {
+	name string
+	// dependencies holds the parent table and the tables referenced by foreign keys.
+	dependencies []string
+	// indexes is the number of secondary indexes on the table.
+	indexes int64
+}
+
+// deleteStep is a commit deleting tables, or partitioned DML deleting a large table.
+type deleteStep struct {
+	tables      []string
+	partitioned bool
+}
+
+// resetDatabase deletes all rows from every user table in the database.
+// If keepMigrations is true, the SchemaMigrations table is kept so that the database stays at the same migration version.
+// It must be false for a pool made from plain DDL, whose own table may have the same name.
+func resetDatabase(ctx context.Context, client *spanner.Client, keepMigrations bool) error {
+	return deleteAllRows(ctx, client, keepMigrations, deleteMutationsPerCommit)
+}
+
+func deleteAllRows(ctx context.Context, client *spanner.Client, keepMigrations bool, maxMutations int64) error {
+	tables, err := listTables(ctx, client)
+	if err != nil {
+		return err
+	}
+	byName := map[string]*table{}
+	for _, t := range tables {
+		byName[t.name] = t
+	}
+	order := []*table{}
+	rows := map[string]int64{}
+	for _, name := range deleteOrder(tables) {
+		if keepMigrations && name == schemaMigrationsTable {
+			continue
+		}
+		var count int64
+		if err := client.Single().Query(ctx, spanner.NewStatement(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdentifier(name)))).Do(func(row *spanner.Row) error {
+			return row.Columns(&count)
+		}); err != nil {
+			return err
+		}
+		order = append(order, byName[name])
+		rows[name] = count
+	}
+	for _, step := range planDeletes(order, rows, maxMutations) {
+		if step.partitioned {
+			if _, err := client.PartitionedUpdate(ctx, spanner.NewStatement(fmt.Sprintf("DELETE FROM %s WHERE true", quoteIdentifier(step.tables[0])))); err != nil {
+				return err
+			}
+			continue
+		}
+		ms := make([]*spanner.Mutation, 0, len(step.tables))
+		for _, name := range step.tables {
+			ms = append(ms, spanner.Delete(name, spanner.AllKeys()))
+		}
+		if _, err := client.Apply(ctx, ms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planDeletes splits deleting the tables in order into steps.
+// Consecutive small tables are deleted together as long as their rows and index entries fit in maxMutations,
+// and tables which do not fit alone are deleted with partitioned DML. Empty tables are skipped.
+func planDeletes(order []*table, rows map[string]int64, maxMutations int64) []deleteStep {
+	var steps []deleteStep
+	var batch []string
+	var mutations int64
+	flush := func() {
+		if len(batch) > 0 {
+			steps = append(steps, deleteStep{tables: batch})
+		}
+		batch = nil
+		mutations = 0
+	}
+	for _, t := range order {
+		count := rows[t.name]
+		if count == 0 {
+			continue
+		}
+		m := count * (1 + t.indexes)
+		if count > partitionedDeleteThreshold || m > maxMutations {
+			// Tables deleted so far must be empty before this table to respect the order.
+			flush()
+			steps = append(steps, deleteStep{tables: []string{t.name}, partitioned: true})
+			continue
+		}
+		if mutations+m > maxMutations {
+			flush()
+		}
+		batch = append(batch, t.name)
+		mutations += m
+	}
+	flush()
+	return steps
+}
+
+// listTables lists user tables with their interleaving parents, foreign key references and the number of indexes.
+func listTables(ctx context.Context, client *spanner.Client) ([]*table, error) {
+	txn := client.ReadOnlyTransaction()
+	defer txn.Close()
+
+	tables := map[string]*table{}
+	if err := txn.Query(ctx, spanner.NewStatement(`SELECT TABLE_SCHEMA, TABLE_NAME, PARENT_TABLE_NAME `+
+		`FROM INFORMATION_SCHEMA.TABLES `+
+		`WHERE TABLE_SCHEMA NOT IN ('INFORMATION_SCHEMA', 'SPANNER_SYS') AND TABLE_TYPE = 'BASE TABLE'`,
+	)).Do(func(row *spanner.Row) error {
+		var schema, name string
+		var parent spanner.NullString
+		if err := row.Columns(&schema, &name, &parent); err != nil {
+			return err
+		}
+		t := &table{name: qualifiedName(schema, name)}
+		if parent.Valid {
+			t.dependencies = append(t.dependencies, qualifiedName(schema, parent.StringVal))
+		}
+		tables[t.name] = t
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := txn.Query(ctx, spanner.NewStatement(`SELECT TABLE_SCHEMA, TABLE_NAME, COUNT(*) `+
+		`FROM INFORMATION_SCHEMA.INDEXES `+
+		`WHERE TABLE_SCHEMA NOT IN ('INFORMATION_SCHEMA', 'SPANNER_SYS') AND INDEX_TYPE = 'INDEX' `+
+		`GROUP BY TABLE_SCHEMA, TABLE_NAME`,
+	)).Do(func(row *spanner.Row) error {
+		var schema, name string
+		var count int64
+		if err := row.Columns(&schema, &name, &count); err != nil {
+			return err
+		}
+		if t, ok := tables[qualifiedName(schema, name)]; ok {
+			t.indexes = count
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	iter := txn.Query(ctx, spanner.NewStatement(`SELECT fk.TABLE_SCHEMA, fk.TABLE_NAME, pk.TABLE_SCHEMA, pk.TABLE_NAME `+
+		`FROM INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS AS rc `+
+		`JOIN INFORMATION_SCHEMA.TABLE_CONSTRAINTS AS fk ON rc.CONSTRAINT_SCHEMA = fk.CONSTRAINT_SCHEMA AND rc.CONSTRAINT_NAME = fk.CONSTRAINT_NAME `+
+		`JOIN INFORMATION_SCHEMA.TABLE_CONSTRAINTS AS pk ON rc.UNIQUE_CONSTRAINT_SCHEMA = pk.CONSTRAINT_SCHEMA AND rc.UNIQUE_CONSTRAINT_NAME = pk.CONSTRAINT_NAME`,
+	))
+	defer iter.Stop()
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var fkSchema, fkName, pkSchema, pkName string
+		if err := row.Columns(&fkSchema, &fkName, &pkSchema, &pkName); err != nil {
+			return nil, err
+		}
+		if t, ok := tables[qualifiedName(fkSchema, fkName)]; ok {
+			t.dependencies = append(t.dependencies, qualifiedName(pkSchema, pkName))
+		}
+	}
+
+	res := make([]*table, 0, len(tables))
+	for _, t := range tables {
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// deleteOrder returns the table names in the order to delete rows.
+// A table comes before its interleaving parent and the tables it references.
+// Tables in a reference cycle are returned in name order after the others.
+func deleteOrder(tables []*table) []string {
+	// dependents counts the tables which must be deleted before the key.
+	dependents := map[string]int{}
+	byName := map[string]*table{}
+	for _, t := range tables {
+		byName[t.name] = t
+	}
+	for _, t := range tables {
+		for _, d := range t.dependencies {
+			if _, ok := byName[d]; ok && d != t.name {
+				dependents[d]++
+			}
+		}
+	}
+
+	names := make([]string, 0, len(tables))
+	for _, t := range tables {
+		names = append(names, t.name)
+	}
+	sort.Strings(names)
+
+	res := make([]string, 0, len(tables))
+	done := map[string]bool{}
+	for len(res) < len(names) {
+		progress := false
+		for _, name := range names {
+			if done[name] || dependents[name] > 0 {
+				continue
+			}
+			done[name] = true
+			res = append(res, name)
+			progress = true
+			for _, d := range byName[name].dependencies {
+				if d != name {
+					dependents[d]--
+				}
+			}
+		}
+		if !progress {
+			for _, name := range names {
+				if !done[name] {
+					done[name] = true
+					res = append(res, name)
+				}
+			}
+		}
+	}
+	return res
+}
+
+func qualifiedName(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// quoteIdentifier quotes each part of the qualified name.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + part + "`"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,235 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestDeleteOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		tables []*table
+		expect []string
+	}{
+		"no dependencies": {
+			tables: []*table{{name: "B"}, {name: "A"}},
+			expect: []string{"A", "B"},
+		},
+		"interleaved": {
+			tables: []*table{
+				{name: "Albums", dependencies: []string{"Singers"}},
+				{name: "Singers"},
+				{name: "Songs", dependencies: []string{"Albums"}},
+			},
+			expect: []string{"Songs", "Albums", "Singers"},
+		},
+		"foreign keys": {
+			tables: []*table{
+				{name: "A"},
+				{name: "B", dependencies: []string{"C"}},
+				{name: "C", dependencies: []string{"A"}},
+			},
+			expect: []string{"B", "C", "A"},
+		},
+		"self reference": {
+			tables: []*table{
+				{name: "A", dependencies: []string{"A"}},
+				{name: "B", dependencies: []string{"A"}},
+			},
+			expect: []string{"B", "A"},
+		},
+		"cycle": {
+			tables: []*table{
+				{name: "A", dependencies: []string{"B"}},
+				{name: "B", dependencies: []string{"A"}},
+				{name: "C", dependencies: []string{"A"}},
+			},
+			expect: []string{"C", "A", "B"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := deleteOrder(test.tables); !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("expected %v but got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestPlanDeletes(t *testing.T) {
+	t.Parallel()
+
+	order := []*table{{name: "A"}, {name: "B", indexes: 1}, {name: "C"}, {name: "D"}, {name: "E"}, {name: "F"}}
+	rows := map[string]int64{"A": 40, "B": 30, "C": 0, "D": 30, "E": 150, "F": 10}
+	expect := []deleteStep{
+		// A and B with its index entries make 100 mutations.
+		{tables: []string{"A", "B"}},
+		{tables: []string{"D"}},
+		// E does not fit in a commit.
+		{tables: []string{"E"}, partitioned: true},
+		{tables: []string{"F"}},
+	}
+	if got := planDeletes(order, rows, 100); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v but got %v", expect, got)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	t.Parallel()
+
+	if expected, got := "`Books`", quoteIdentifier("Books"); expected != got {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+	if expected, got := "`sch`.`Books`", quoteIdentifier("sch.Books"); expected != got {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+}
+
+func TestPool_PutWithReset(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+	if _, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix()); err != nil {
+		t.Fatal(err)
+	}
+	sdb, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := spanner.NewClient(ctx, cfg.WithDatabaseID(sdb.DatabaseName).Database(), cfg.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.Insert("Books", []string{"ISBN"}, []interface{}{"isbn"})}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	if err := pool.Put(ctx, sdb.DatabaseName, sdb.CheckoutToken.StringVal, WithReset()); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := client.Single().Query(ctx, spanner.NewStatement("SELECT COUNT(*) FROM Books")).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no rows but got %d", count)
+	}
+	got, err := model.FindSpoolDatabase(ctx, pool.client.Single(), sdb.DatabaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := State(got.State); state != StateIdle {
+		t.Errorf("expected %s but got %s", StateIdle, state)
+	}
+}
+
+func TestPool_PutWithResetSchemaMigrationsTable(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	// A pool from plain DDL owns its SchemaMigrations table, so the table is reset like the others.
+	pool := newPool(ctx, t, cfg, []byte("CREATE TABLE SchemaMigrations (Version INT64 NOT NULL, Dirty BOOL NOT NULL) PRIMARY KEY(Version)"))
+	if _, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix()); err != nil {
+		t.Fatal(err)
+	}
+	sdb, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := spanner.NewClient(ctx, cfg.WithDatabaseID(sdb.DatabaseName).Database(), cfg.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.Insert("SchemaMigrations", []string{"Version", "Dirty"}, []interface{}{int64(1), false})}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	if err := pool.Put(ctx, sdb.DatabaseName, sdb.CheckoutToken.StringVal, WithReset()); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := client.Single().Query(ctx, spanner.NewStatement("SELECT COUNT(*) FROM SchemaMigrations")).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no rows but got %d", count)
+	}
+}
+
+func TestDeleteAllRows_Batches(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	const tables = 12
+	var ddl strings.Builder
+	for i := range tables {
+		fmt.Fprintf(&ddl, "CREATE TABLE T%02d (ID INT64 NOT NULL, Value STRING(MAX)) PRIMARY KEY(ID);\n", i)
+		fmt.Fprintf(&ddl, "CREATE INDEX T%02dByValue ON T%02d(Value);\n", i, i)
+	}
+	pool := newPool(ctx, t, cfg, []byte(ddl.String()))
+	sdb, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := spanner.NewClient(ctx, cfg.WithDatabaseID(sdb.DatabaseName).Database(), cfg.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	ms := []*spanner.Mutation{}
+	for i := range tables {
+		for id := range 5 {
+			ms = append(ms, spanner.Insert(fmt.Sprintf("T%02d", i), []string{"ID", "Value"}, []interface{}{int64(id), "value"}))
+		}
+	}
+	if _, err := client.Apply(ctx, ms); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+
+	// Each table makes 10 mutations with its index, so the tables are deleted in 6 commits.
+	if err := deleteAllRows(ctx, client, false, 20); err != nil {
+		t.Fatal(err)
+	}
+	for i := range tables {
+		var count int64
+		if err := client.Single().Query(ctx, spanner.NewStatement(fmt.Sprintf("SELECT COUNT(*) FROM T%02d", i))).Do(func(row *spanner.Row) error {
+			return row.Columns(&count)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("T%02d: expected no rows but got %d", i, count)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package spool
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudspannerecosystem/memefish"
+	"github.com/cloudspannerecosystem/memefish/ast"
+)
+
+// Schema represents the database objects defined by DDL statements.
+// Objects are kept in the order of their definitions.
+type Schema struct {
+	Tables        []*Table
+	Indexes       []*ast.CreateIndex
+	ChangeStreams []*ast.CreateChangeStream
+	Views         []*ast.CreateView
+}
+
+// Table represents a table with its columns, interleaving and constraints.
+type Table struct {
+	Name       *ast.Path
+	Columns    []*ast.ColumnDef
+	PrimaryKey []*ast.IndexKey
+	// Interleave is the parent table, nil if the table is not interleaved.
+	Interleave *ast.Cluster
+	// Constraints holds foreign keys and check constraints.
+	Constraints       []*ast.TableConstraint
+	RowDeletionPolicy *ast.RowDeletionPolicy
+}
+
+// SQL returns the CREATE TABLE statement of the table.
+func (t *Table) SQL() string {
+	ct := &ast.CreateTable{
+		Name:             t.Name,
+		Columns:          t.Columns,
+		TableConstraints: t.Constraints,
+		PrimaryKeys:      t.PrimaryKey,
+		Cluster:          t.Interleave,
+	}
+	if t.RowDeletionPolicy != nil {
+		ct.RowDeletionPolicy = &ast.CreateRowDeletionPolicy{RowDeletionPolicy: t.RowDeletionPolicy}
+	}
+	return ct.SQL()
+}
+
+// ParseSchema parses ddl and returns the schema after applying the statements in order.
+// Besides CREATE statements, DROP statements and ALTER TABLE statements are supported
+// so that a concatenation of migrations can be parsed.
+func ParseSchema(ddl []byte) (*Schema, error) {
+	stmts, err := memefish.ParseDDLs("", string(ddl))
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{}
+	for _, stmt := range stmts {
+		if err := s.apply(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Table returns the table named name, or nil if it does not exist.
+func (s *Schema) Table(name string) *Table {
+	for _, t := range s.Tables {
+		if sameName(t.Name.SQL(), name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Schema) apply(stmt ast.DDL) error {
+	switch stmt := stmt.(type) {
+	case *ast.CreateTable:
+		if s.Table(stmt.Name.SQL()) != nil {
+			if stmt.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("table %s already exists", stmt.Name.SQL())
+		}
+		t := &Table{
+			Name:        stmt.Name,
+			Columns:     stmt.Columns,
+			PrimaryKey:  stmt.PrimaryKeys,
+			Interleave:  stmt.Cluster,
+			Constraints: stmt.TableConstraints,
+		}
+		if stmt.RowDeletionPolicy != nil {
+			t.RowDeletionPolicy = stmt.RowDeletionPolicy.RowDeletionPolicy
+		}
+		s.Tables = append(s.Tables, t)
+	case *ast.AlterTable:
+		t := s.Table(stmt.Name.SQL())
+		if t == nil {
+			return fmt.Errorf("table %s not found", stmt.Name.SQL())
+		}
+		return t.alter(stmt.TableAlteration)
+	case *ast.DropTable:
+		i := indexOf(s.Tables, func(t *Table) string { return t.Name.SQL() }, stmt.Name.SQL())
+		if i < 0 {
+			if stmt.IfExists {
+				return nil
+			}
+			return fmt.Errorf("table %s not found", stmt.Name.SQL())
+		}
+		s.Tables = slices.Delete(s.Tables, i, i+1)
+	case *ast.CreateIndex:
+		if indexOf(s.Indexes, indexName, stmt.Name.SQL()) >= 0 {
+			if stmt.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("index %s already exists", stmt.Name.SQL())
+		}
+		s.Indexes = append(s.Indexes, stmt)
+	case *ast.DropIndex:
+		i := indexOf(s.Indexes, indexName, stmt.Name.SQL())
+		if i < 0 {
+			if stmt.IfExists {
+				return nil
+			}
+			return fmt.Errorf("index %s not found", stmt.Name.SQL())
+		}
+		s.Indexes = slices.Delete(s.Indexes, i, i+1)
+	case *ast.CreateChangeStream:
+		if indexOf(s.ChangeStreams, changeStreamName, stmt.Name.SQL()) >= 0 {
+			return fmt.Errorf("change stream %s already exists", stmt.Name.SQL())
+		}
+		s.ChangeStreams = append(s.ChangeStreams, stmt)
+	case *ast.DropChangeStream:
+		i := indexOf(s.ChangeStreams, changeStreamName, stmt.Name.SQL())
+		if i < 0 {
+			return fmt.Errorf("change stream %s not found", stmt.Name.SQL())
+		}
+		s.ChangeStreams = slices.Delete(s.ChangeStreams, i, i+1)
+	case *ast.CreateView:
+		if i := indexOf(s.Views, viewName, stmt.Name.SQL()); i >= 0 {
+			if !stmt.OrReplace {
+				return fmt.Errorf("view %s already exists", stmt.Name.SQL())
+			}
+			s.Views[i] = stmt
+			return nil
+		}
+		s.Views = append(s.Views, stmt)
+	case *ast.DropView:
+		i := indexOf(s.Views, viewName, stmt.Name.SQL())
+		if i < 0 {
+			return fmt.Errorf("view %s not found", stmt.Name.SQL())
+		}
+		s.Views = slices.Delete(s.Views, i, i+1)
+	default:
+		return fmt.Errorf("unsupported statement in schema: %s", stmt.SQL())
+	}
+	return nil
+}
+
+func (t *Table) alter(alteration ast.TableAlteration) error {
+	switch a := alteration.(type) {
+	case *ast.AddColumn:
+		if t.column(a.Column.Name.SQL()) >= 0 {
+			if a.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("column %s.%s already exists", t.Name.SQL(), a.Column.Name.SQL())
+		}
+		t.Columns = append(t.Columns, a.Column)
+	case *ast.DropColumn:
+		i := t.column(a.Name.SQL())
+		if i < 0 {
+			return fmt.Errorf("column %s.%s not found", t.Name.SQL(), a.Name.SQL())
+		}
+		t.Columns = slices.Delete(t.Columns, i, i+1)
+	case *ast.AlterColumn:
+		i := t.column(a.Name.SQL())
+		if i < 0 {
+			return fmt.Errorf("column %s.%s not found", t.Name.SQL(), a.Name.SQL())
+		}
+		c := *t.Columns[i]
+		switch ca := a.Alteration.(type) {
+		case *ast.AlterColumnType:
+			c.Type = ca.Type
+			c.NotNull = ca.NotNull
+			c.DefaultSemantics = nil
+			if ca.DefaultExpr != nil {
+				c.DefaultSemantics = ca.DefaultExpr
+			}
+		case *ast.AlterColumnSetOptions:
+			c.Options = ca.Options
+		case *ast.AlterColumnSetDefault:
+			c.DefaultSemantics = ca.DefaultExpr
+		case *ast.AlterColumnDropDefault:
+			c.DefaultSemantics = nil
+		default:
+			return fmt.Errorf("unsupported column alteration in schema: %s", a.SQL())
+		}
+		t.Columns = slices.Clone(t.Columns)
+		t.Columns[i] = &c
+	case *ast.AddTableConstraint:
+		t.Constraints = append(t.Constraints, a.TableConstraint)
+	case *ast.DropConstraint:
+		i := slices.IndexFunc(t.Constraints, func(c *ast.TableConstraint) bool {
+			return c.Name != nil && sameName(c.Name.SQL(), a.Name.SQL())
+		})
+		if i < 0 {
+			return fmt.Errorf("constraint %s not found in %s", a.Name.SQL(), t.Name.SQL())
+		}
+		t.Constraints = slices.Delete(t.Constraints, i, i+1)
+	case *ast.SetOnDelete:
+		if t.Interleave == nil {
+			return fmt.Errorf("table %s is not interleaved", t.Name.SQL())
+		}
+		cluster := *t.Interleave
+		cluster.OnDelete = a.OnDelete
+		t.Interleave = &cluster
+	case *ast.AddRowDeletionPolicy:
+		t.RowDeletionPolicy = a.RowDeletionPolicy
+	case *ast.ReplaceRowDeletionPolicy:
+		t.RowDeletionPolicy = a.RowDeletionPolicy
+	case *ast.DropRowDeletionPolicy:
+		t.RowDeletionPolicy = nil
+	default:
+		return fmt.Errorf("unsupported table alteration in schema: %s", alteration.SQL())
+	}
+	return nil
+}
+
+func (t *Table) column(name string) int {
+	return indexOf(t.Columns, func(c *ast.ColumnDef) string { return c.Name.SQL() }, name)
+}
+
+func indexName(i *ast.CreateIndex) string               { return i.Name.SQL() }
+func changeStreamName(c *ast.CreateChangeStream) string { return c.Name.SQL() }
+func viewName(v *ast.CreateView) string                 { return v.Name.SQL() }
+
+// indexOf returns the index of the object named name in objects, or -1.
+func indexOf[T any](objects []T, nameOf func(T) string, name string) int {
+	return slices.IndexFunc(objects, func(o T) bool {
+		return sameName(nameOf(o), name)
+	})
+}
+
+// sameName reports whether the names refer to the same object. Spanner names are case-insensitive.
+func sameName(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
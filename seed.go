@@ -0,0 +1,295 @@
+package spool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// seedBatchSize is the number of rows inserted in a single transaction.
+const seedBatchSize = 1000
+
+// Seed represents data loaded into each pooled database.
+type Seed struct {
+	fixtures   []*fixture
+	statements []string
+	checksum   string
+}
+
+// fixture represents rows of a table.
+type fixture struct {
+	table string
+	rows  []map[string]*string
+}
+
+// LoadSeed loads a Seed from DML SQL files, CSV/JSON fixture files and directories containing them.
+// The table name of a fixture is its file name without the extension.
+// In CSV fixtures the first record is the column names and an empty field is NULL.
+// JSON fixtures are an array of objects whose keys are column names.
+func LoadSeed(paths ...string) (*Seed, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			switch filepath.Ext(entry.Name()) {
+			case ".sql", ".csv", ".json":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	seed := &Seed{}
+	h := sha256.New()
+	for _, file := range files {
+		b, err := os.ReadFile(file) // #nosec G304 -- reading the given seed file is intended
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.Base(file), len(b))
+		h.Write(b)
+
+		table := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		switch filepath.Ext(file) {
+		case ".csv":
+			f, err := parseCSVFixture(table, b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			seed.fixtures = append(seed.fixtures, f)
+		case ".json":
+			f, err := parseJSONFixture(table, b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			seed.fixtures = append(seed.fixtures, f)
+		default:
+			stmts, err := ddlToStatements(b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			seed.statements = append(seed.statements, stmts...)
+		}
+	}
+	seed.checksum = fmt.Sprintf("%x", h.Sum(nil))
+	return seed, nil
+}
+
+// Checksum returns the checksum of the seed contents.
+func (s *Seed) Checksum() string {
+	return s.checksum
+}
+
+func parseCSVFixture(table string, b []byte) (*fixture, error) {
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	f := &fixture{table: table}
+	if len(records) == 0 {
+		return f, nil
+	}
+	columns := records[0]
+	for _, record := range records[1:] {
+		row := make(map[string]*string, len(columns))
+		for i, column := range columns {
+			if record[i] == "" {
+				row[column] = nil
+				continue
+			}
+			v := record[i]
+			row[column] = &v
+		}
+		f.rows = append(f.rows, row)
+	}
+	return f, nil
+}
+
+func parseJSONFixture(table string, b []byte) (*fixture, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var objs []map[string]interface{}
+	if err := dec.Decode(&objs); err != nil {
+		return nil, err
+	}
+	f := &fixture{table: table}
+	for _, obj := range objs {
+		row := make(map[string]*string, len(obj))
+		for column, value := range obj {
+			var v string
+			switch value := value.(type) {
+			case nil:
+				row[column] = nil
+				continue
+			case string:
+				v = value
+			case json.Number:
+				v = value.String()
+			case bool:
+				v = fmt.Sprint(value)
+			default:
+				// Objects and arrays are stored as JSON text.
+				b, err := json.Marshal(value)
+				if err != nil {
+					return nil, err
+				}
+				v = string(b)
+			}
+			row[column] = &v
+		}
+		f.rows = append(f.rows, row)
+	}
+	return f, nil
+}
+
+// applySeed loads the seed into the database.
+// Fixtures are inserted parents first, then the DML statements are executed in order.
+func applySeed(ctx context.Context, client *spanner.Client, seed *Seed) error {
+	tables, err := listTables(ctx, client)
+	if err != nil {
+		return err
+	}
+	// Parents come after their children in the delete order.
+	rank := map[string]int{}
+	for i, name := range deleteOrder(tables) {
+		rank[name] = i
+	}
+	fixtures := make([]*fixture, len(seed.fixtures))
+	copy(fixtures, seed.fixtures)
+	sort.SliceStable(fixtures, func(i, j int) bool {
+		return rank[fixtures[i].table] > rank[fixtures[j].table]
+	})
+
+	for _, f := range fixtures {
+		types, err := columnTypes(ctx, client, f.table)
+		if err != nil {
+			return err
+		}
+		stmts := make([]spanner.Statement, 0, len(f.rows))
+		for _, row := range f.rows {
+			stmt, err := insertStatement(f.table, types, row)
+			if err != nil {
+				return err
+			}
+			stmts = append(stmts, stmt)
+		}
+		if err := batchUpdate(ctx, client, stmts); err != nil {
+			return fmt.Errorf("failed to load fixture of %s: %w", f.table, err)
+		}
+	}
+
+	stmts := make([]spanner.Statement, 0, len(seed.statements))
+	for _, s := range seed.statements {
+		stmts = append(stmts, spanner.NewStatement(s))
+	}
+	return batchUpdate(ctx, client, stmts)
+}
+
+func batchUpdate(ctx context.Context, client *spanner.Client, stmts []spanner.Statement) error {
+	for start := 0; start < len(stmts); start += seedBatchSize {
+		batch := stmts[start:min(start+seedBatchSize, len(stmts))]
+		if _, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+			_, err := txn.BatchUpdate(ctx, batch)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnTypes returns the Spanner types of the columns in the table.
+func columnTypes(ctx context.Context, client *spanner.Client, table string) (map[string]string, error) {
+	schema, name := "", table
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		schema, name = table[:i], table[i+1:]
+	}
+	stmt := spanner.NewStatement(`SELECT COLUMN_NAME, SPANNER_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = @schema AND TABLE_NAME = @name`)
+	stmt.Params["schema"] = schema
+	stmt.Params["name"] = name
+	types := map[string]string{}
+	if err := client.Single().Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		var column, typ string
+		if err := row.Columns(&column, &typ); err != nil {
+			return err
+		}
+		types[column] = typ
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return types, nil
+}
+
+// insertStatement builds an INSERT statement which converts string values to the column types.
+func insertStatement(table string, types map[string]string, row map[string]*string) (spanner.Statement, error) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	stmt := spanner.Statement{Params: map[string]interface{}{}}
+	names := make([]string, 0, len(columns))
+	exprs := make([]string, 0, len(columns))
+	for i, column := range columns {
+		typ, ok := types[column]
+		if !ok {
+			return stmt, fmt.Errorf("column %s.%s not found", table, column)
+		}
+		param := fmt.Sprintf("p%d", i)
+		expr, err := castExpr(typ, "@"+param)
+		if err != nil {
+			return stmt, fmt.Errorf("column %s.%s: %w", table, column, err)
+		}
+		if v := row[column]; v != nil {
+			stmt.Params[param] = *v
+		} else {
+			stmt.Params[param] = spanner.NullString{}
+		}
+		names = append(names, quoteIdentifier(column))
+		exprs = append(exprs, expr)
+	}
+	stmt.SQL = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdentifier(table), strings.Join(names, ", "), strings.Join(exprs, ", "))
+	return stmt, nil
+}
+
+// castExpr returns an expression which converts the string parameter to typ.
+func castExpr(typ, param string) (string, error) {
+	switch {
+	case strings.HasPrefix(typ, "STRING"):
+		return param, nil
+	case strings.HasPrefix(typ, "BYTES"):
+		return fmt.Sprintf("FROM_BASE64(%s)", param), nil
+	case typ == "JSON":
+		return fmt.Sprintf("PARSE_JSON(%s)", param), nil
+	case typ == "INT64", typ == "FLOAT64", typ == "FLOAT32", typ == "NUMERIC", typ == "BOOL", typ == "DATE", typ == "TIMESTAMP":
+		return fmt.Sprintf("CAST(%s AS %s)", param, typ), nil
+	}
+	return "", fmt.Errorf("unsupported type in fixtures: %s", typ)
+}
@@ -0,0 +1,124 @@
+package spool
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestLoadSeed(t *testing.T) {
+	t.Parallel()
+
+	seed, err := LoadSeed("testdata/seed", "testdata/seed_json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seed.fixtures) != 2 {
+		t.Fatalf("expected 2 fixtures but got %d", len(seed.fixtures))
+	}
+	for _, f := range seed.fixtures {
+		if f.table != "Books" {
+			t.Errorf("expected Books but got %s", f.table)
+		}
+		if len(f.rows) != 2 {
+			t.Fatalf("expected 2 rows but got %d", len(f.rows))
+		}
+		if v := f.rows[1]["Title"]; v != nil {
+			t.Errorf("expected NULL but got %s", *v)
+		}
+	}
+	if len(seed.statements) != 1 {
+		t.Errorf("expected 1 statement but got %d", len(seed.statements))
+	}
+
+	another, err := LoadSeed("testdata/seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed.Checksum() == another.Checksum() {
+		t.Error("checksum should differ by seed contents")
+	}
+}
+
+func TestInsertStatement(t *testing.T) {
+	t.Parallel()
+
+	id, title := "1", "Spanner"
+	types := map[string]string{"ID": "INT64", "Title": "STRING(MAX)", "Data": "JSON"}
+	stmt, err := insertStatement("Books", types, map[string]*string{"ID": &id, "Title": &title, "Data": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "INSERT INTO `Books` (`Data`, `ID`, `Title`) VALUES (PARSE_JSON(@p0), CAST(@p1 AS INT64), @p2)"; stmt.SQL != expected {
+		t.Errorf("expected %s but got %s", expected, stmt.SQL)
+	}
+	if v, ok := stmt.Params["p0"].(spanner.NullString); !ok || v.Valid {
+		t.Errorf("expected NULL but got %v", stmt.Params["p0"])
+	}
+
+	if _, err := insertStatement("Books", types, map[string]*string{"Unknown": &id}); err == nil {
+		t.Error("expected error for unknown column but no error")
+	}
+	if _, err := insertStatement("Books", map[string]string{"Tags": "ARRAY<STRING(MAX)>"}, map[string]*string{"Tags": &id}); err == nil {
+		t.Error("expected error for unsupported type but no error")
+	}
+}
+
+func TestPool_CreateWithSeed(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	seed, err := LoadSeed("testdata/seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewPool(ctx, cfg, ddl2, WithSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.checksum == ddlChecksum(t, ddl2) {
+		t.Error("checksum should include the seed")
+	}
+	if _, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix()); err != nil {
+		t.Fatal(err)
+	}
+	sdb, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := spanner.NewClient(ctx, cfg.WithDatabaseID(sdb.DatabaseName).Database(), cfg.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	countBooks := func() int64 {
+		t.Helper()
+		var count int64
+		if err := client.Single().Query(ctx, spanner.NewStatement("SELECT COUNT(*) FROM Books")).Do(func(row *spanner.Row) error {
+			return row.Columns(&count)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	if count := countBooks(); count != 3 {
+		t.Errorf("expected 3 seeded rows but got %d", count)
+	}
+
+	if _, err := client.Apply(ctx, []*spanner.Mutation{spanner.Insert("Books", []string{"ISBN", "Title"}, []interface{}{"isbn", "title"})}); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+	if err := pool.Put(ctx, sdb.DatabaseName, sdb.CheckoutToken.StringVal, WithReset()); err != nil {
+		t.Fatal(err)
+	}
+	if count := countBooks(); count != 3 {
+		t.Errorf("expected 3 seeded rows after reset but got %d", count)
+	}
+}
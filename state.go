@@ -0,0 +1,77 @@
+package spool
+
+import (
+	"fmt"
+
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+// State represents a state of the database.
+type State int64
+
+const (
+	// StateIdle represents a idle state.
+	StateIdle State = iota
+	// StateBusy represents a busy state.
+	StateBusy
+	// StateNotFound represents a database does not exist state.
+	StateNotFound
+	// StateQuarantined represents a state of the database which must not be reused.
+	StateQuarantined
+	// StateCreating represents a state of the database whose creation is in progress.
+	StateCreating
+	// StateDeleting represents a state of the database which is being dropped by Clean.
+	StateDeleting
+)
+
+// Int64 returns s as int64.
+func (s State) Int64() int64 {
+	return int64(s)
+}
+
+// String returns a string representing the state.
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateBusy:
+		return "busy"
+	case StateNotFound:
+		return "notfound"
+	case StateQuarantined:
+		return "quarantined"
+	case StateCreating:
+		return "creating"
+	case StateDeleting:
+		return "deleting"
+	}
+	return "unknown"
+}
+
+// transitions holds the states which each state can change to.
+// A busy database can become busy again when its lease has expired and someone else takes it.
+// Any database except one being created can be dropped by Clean, and a deleting database never comes back.
+var transitions = map[State][]State{
+	StateIdle:        {StateBusy, StateNotFound, StateDeleting},
+	StateBusy:        {StateIdle, StateBusy, StateQuarantined, StateNotFound, StateDeleting},
+	StateNotFound:    {StateDeleting},
+	StateQuarantined: {StateDeleting},
+	StateCreating:    {StateIdle, StateBusy},
+}
+
+func (s State) canTransitionTo(to State) bool {
+	for _, t := range transitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+func changeState(sdb *model.SpoolDatabase, to State) error {
+	if from := State(sdb.State); !from.canTransitionTo(to) {
+		return fmt.Errorf("%w: %s cannot change from %s to %s", ErrInvalidTransition, sdb.DatabaseName, from, to)
+	}
+	sdb.ChangeState(to.Int64())
+	return nil
+}
@@ -0,0 +1,59 @@
+package spool
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestChangeState(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		from State
+		to   State
+		fail bool
+	}{
+		"idle to busy":            {from: StateIdle, to: StateBusy},
+		"busy to idle":            {from: StateBusy, to: StateIdle},
+		"busy to quarantined":     {from: StateBusy, to: StateQuarantined},
+		"idle to idle":            {from: StateIdle, to: StateIdle, fail: true},
+		"notfound to idle":        {from: StateNotFound, to: StateIdle, fail: true},
+		"quarantined to idle":     {from: StateQuarantined, to: StateIdle, fail: true},
+		"idle to quarantined":     {from: StateIdle, to: StateQuarantined, fail: true},
+		"notfound to quarantined": {from: StateNotFound, to: StateQuarantined, fail: true},
+		"creating to idle":        {from: StateCreating, to: StateIdle},
+		"creating to busy":        {from: StateCreating, to: StateBusy},
+		"idle to creating":        {from: StateIdle, to: StateCreating, fail: true},
+		"creating to notfound":    {from: StateCreating, to: StateNotFound, fail: true},
+		"idle to deleting":        {from: StateIdle, to: StateDeleting},
+		"busy to deleting":        {from: StateBusy, to: StateDeleting},
+		"quarantined to deleting": {from: StateQuarantined, to: StateDeleting},
+		"creating to deleting":    {from: StateCreating, to: StateDeleting, fail: true},
+		"deleting to idle":        {from: StateDeleting, to: StateIdle, fail: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sdb := &model.SpoolDatabase{State: test.from.Int64()}
+			err := changeState(sdb, test.to)
+			if test.fail {
+				if !errors.Is(err, ErrInvalidTransition) {
+					t.Fatalf("expected ErrInvalidTransition but got %v", err)
+				}
+				if state := State(sdb.State); state != test.from {
+					t.Errorf("state should not change: got %s", state)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if state := State(sdb.State); state != test.to {
+				t.Errorf("expected %s but got %s", test.to, state)
+			}
+		})
+	}
+}
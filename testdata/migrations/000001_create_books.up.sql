@@ -0,0 +1,3 @@
+CREATE TABLE Books (
+  ISBN STRING(MAX) NOT NULL,
+) PRIMARY KEY(ISBN);
@@ -0,0 +1 @@
+ALTER TABLE Books ADD COLUMN Title STRING(MAX)
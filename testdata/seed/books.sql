@@ -0,0 +1 @@
+INSERT INTO Books (ISBN, Title) VALUES ('3', 'Spool');
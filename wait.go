@@ -0,0 +1,113 @@
+package spool
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+const (
+	// minWaitInterval and maxWaitInterval bound the interval at which a waiter polls the pool.
+	// The interval starts at minWaitInterval and doubles up to maxWaitInterval.
+	minWaitInterval = time.Second
+	maxWaitInterval = 10 * time.Second
+	// staleWaiter is the age of the last heartbeat after which a waiter is regarded as gone.
+	staleWaiter = time.Minute
+)
+
+// wait calls attempt until it succeeds, fails with an error for which retry returns false, or timeout expires.
+//
+// The first attempt is made right away, so callers which need not wait, such as concurrent GetOrCreate calls
+// creating databases in a pool below its maximum size, never queue behind each other.
+// After an attempt which should be retried, the caller is registered in the SpoolWaiters table so that waiters
+// are served in rough FIFO order: a waiter attempts only when it is the oldest live waiter or there are
+// at least as many available databases as waiters ahead of it. When timeout expires, the error of a final attempt is returned.
+func (p *Pool) wait(ctx context.Context, timeout time.Duration, attempt func(ctx context.Context) (*model.SpoolDatabase, error), retry func(err error) bool) (*model.SpoolDatabase, error) {
+	deadline := time.Now().Add(timeout)
+	if sdb, err := attempt(ctx); err == nil || !retry(err) {
+		return sdb, err
+	}
+
+	waiterID, err := newCheckoutToken()
+	if err != nil {
+		return nil, err
+	}
+	w := &model.SpoolWaiter{
+		Checksum:    p.checksum,
+		WaiterID:    waiterID,
+		CreatedAt:   spanner.CommitTimestamp,
+		HeartbeatAt: spanner.CommitTimestamp,
+	}
+	ts, err := p.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		if _, err := model.DeleteStaleSpoolWaiters(ctx, txn, p.checksum, staleWaiter); err != nil {
+			return err
+		}
+		return txn.BufferWrite([]*spanner.Mutation{w.Insert(ctx)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.CreatedAt = ts
+	defer func() {
+		_, _ = p.client.Apply(context.WithoutCancel(ctx), []*spanner.Mutation{w.Delete(ctx)})
+	}()
+
+	interval := minWaitInterval
+	for {
+		if !time.Now().Before(deadline) {
+			return attempt(ctx)
+		}
+		turn, err := p.heartbeat(ctx, w)
+		if err != nil {
+			return nil, err
+		}
+		if turn {
+			sdb, err := attempt(ctx)
+			if err == nil || !retry(err) {
+				return sdb, err
+			}
+		}
+		if err := sleep(ctx, min(jitter(interval), time.Until(deadline))); err != nil {
+			return nil, err
+		}
+		interval = min(interval*2, maxWaitInterval)
+	}
+}
+
+// heartbeat keeps the waiter alive and reports whether it is the turn of the waiter to attempt.
+func (p *Pool) heartbeat(ctx context.Context, w *model.SpoolWaiter) (bool, error) {
+	w.HeartbeatAt = spanner.CommitTimestamp
+	m, err := w.UpdateColumns(ctx, "HeartbeatAt")
+	if err != nil {
+		return false, err
+	}
+	if _, err := p.client.Apply(ctx, []*spanner.Mutation{m}); err != nil {
+		return false, err
+	}
+
+	txn := p.client.ReadOnlyTransaction()
+	defer txn.Close()
+	ahead, err := model.CountSpoolWaitersAhead(ctx, txn, w.Checksum, w.CreatedAt, w.WaiterID, staleWaiter)
+	if err != nil {
+		return false, err
+	}
+	if ahead == 0 {
+		return true, nil
+	}
+	available, err := model.CountAvailableSpoolDatabasesByChecksums(ctx, txn, p.availableChecksums(), StateIdle.Int64(), StateBusy.Int64())
+	if err != nil {
+		return false, err
+	}
+	return ahead < available, nil
+}
+
+// jitter returns a random duration between d/2 and d so that waiters do not poll in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d < 2 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
@@ -0,0 +1,161 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/cloudspannerecosystem/spool/model"
+)
+
+func TestJitter(t *testing.T) {
+	t.Parallel()
+
+	for _, d := range []time.Duration{minWaitInterval, maxWaitInterval} {
+		for range 100 {
+			if got := jitter(d); got < d/2 || got >= d {
+				t.Fatalf("jitter(%s) = %s, expected in [%s, %s)", d, got, d/2, d)
+			}
+		}
+	}
+}
+
+func TestPool_GetWait(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool := newPool(ctx, t, cfg, ddl1)
+
+	if _, err := pool.Get(ctx, WithWaitTimeout(time.Second)); !isErrNotFound(err) {
+		t.Fatalf("expected not found error but got %v", err)
+	}
+
+	if _, err := pool.Create(ctx, spoolSpannerDatabaseNamePrefix()); err != nil {
+		t.Fatal(err)
+	}
+	held, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(2 * time.Second)
+		if err := pool.Put(ctx, held.DatabaseName, held.CheckoutToken.StringVal); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	sdb, err := pool.Get(ctx, WithWaitTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdb.DatabaseName != held.DatabaseName {
+		t.Errorf("expected %s but got %s", held.DatabaseName, sdb.DatabaseName)
+	}
+	if sdb.HeldBy(held.CheckoutToken.StringVal) {
+		t.Error("expected a new checkout token")
+	}
+}
+
+func TestPool_GetOrCreateWaitConcurrently(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	_, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	pool, err := NewPool(ctx, cfg, ddl1, WithMaxSize(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Callers which can create must not wait for each other even with a wait timeout.
+	const callers = 2
+	var wg sync.WaitGroup
+	sdbs := make([]*model.SpoolDatabase, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sdbs[i], errs[i] = pool.GetOrCreate(ctx, spoolSpannerDatabaseNamePrefix(), WithWaitTimeout(10*time.Minute))
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sdbs[0].DatabaseName == sdbs[1].DatabaseName {
+		t.Fatalf("expected different databases but both got %s", sdbs[0].DatabaseName)
+	}
+	// Both rows are reserved before either creation completes.
+	for i, sdb := range sdbs {
+		other := sdbs[1-i]
+		if !sdb.CreatedAt.Before(other.UpdatedAt) {
+			t.Errorf("expected %s to be reserved at %s before %s was created at %s", sdb.DatabaseName, sdb.CreatedAt, other.DatabaseName, other.UpdatedAt)
+		}
+	}
+}
+
+func TestPool_HeartbeatPreviousChecksums(t *testing.T) {
+	t.Parallel()
+
+	cfg := SetupTestDatabase(t)
+
+	ctx := context.Background()
+	client, truncate := connect(ctx, t, cfg)
+	t.Cleanup(truncate)
+
+	migrations, err := LoadMigrations("testdata/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewPoolFromMigrations(ctx, cfg, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Get upgrades idle databases of the earlier version, so they count as available for waiters.
+	ms := []*spanner.Mutation{}
+	for checksum := range pool.previousChecksums {
+		for i := range 2 {
+			sdb := &model.SpoolDatabase{
+				DatabaseName: fmt.Sprintf("zoncoen-spool-test-%d", i),
+				Checksum:     checksum,
+				State:        StateIdle.Int64(),
+				CreatedAt:    spanner.CommitTimestamp,
+				UpdatedAt:    spanner.CommitTimestamp,
+			}
+			ms = append(ms, sdb.Insert(ctx))
+		}
+	}
+	ahead := &model.SpoolWaiter{Checksum: pool.checksum, WaiterID: "ahead", CreatedAt: spanner.CommitTimestamp, HeartbeatAt: spanner.CommitTimestamp}
+	ms = append(ms, ahead.Insert(ctx))
+	if _, err := client.Apply(ctx, ms); err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+	w := &model.SpoolWaiter{Checksum: pool.checksum, WaiterID: "waiter", CreatedAt: spanner.CommitTimestamp, HeartbeatAt: spanner.CommitTimestamp}
+	ts, err := client.Apply(ctx, []*spanner.Mutation{w.Insert(ctx)})
+	if err != nil {
+		t.Fatalf("failed to setup fixture: %s", err)
+	}
+	w.CreatedAt = ts
+
+	turn, err := pool.heartbeat(ctx, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !turn {
+		t.Error("expected the turn of the waiter with more available databases than waiters ahead")
+	}
+}